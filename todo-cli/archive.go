@@ -0,0 +1,405 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aquasecurity/table"
+)
+
+// archiveDir is the directory in the data directory that holds the
+// archives, one subdirectory per list.
+const archiveDir = "archive"
+
+// archiveMonthFormat names archive files after the month their todos were
+// closed in, e.g. archive/todos/2024-05.json.
+const archiveMonthFormat = "2006-01"
+
+// archivedTodo is a todo moved out of its list into the archive.
+type archivedTodo struct {
+	Todo
+	ArchivedAt time.Time
+}
+
+func listArchiveDir(list string) string {
+	return filepath.Join(global.config.DataDir, archiveDir, list)
+}
+
+// archiveFiles returns the archive files of a list, oldest month first.
+func archiveFiles(list string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(listArchiveDir(list), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(files)
+	return files, nil
+}
+
+// listEncrypted reports whether the stored list is encrypted. Archives are
+// encrypted whenever their list is.
+func listEncrypted(list string) bool {
+	return isSealedFile(listFile(list))
+}
+
+// closedAt returns when a closed todo was closed, or its creation time if
+// that was never recorded.
+func (t Todo) closedAt() time.Time {
+	if at := t.enteredAt(); at != nil {
+		return *at
+	}
+	return t.CreatedAt
+}
+
+// parseAge parses how long ago something happened, as days ("14d"), weeks
+// ("2w") or a Go duration ("36h").
+func parseAge(s string) (time.Duration, error) {
+	invalid := fmt.Errorf("invalid age %q (e.g. 14d, 2w or 36h)", s)
+	if a := amount.FindStringSubmatch(strings.ToLower(strings.TrimSpace(s))); a != nil {
+		n, _ := strconv.Atoi(a[1])
+		switch strings.TrimSuffix(a[2], "s") {
+		case "d", "day":
+			return time.Duration(n) * 24 * time.Hour, nil
+		case "w", "wk", "week":
+			return time.Duration(n) * 7 * 24 * time.Hour, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, invalid
+	}
+	return d, nil
+}
+
+// archiveTodos moves the todos of list that were closed before cutoff into
+// its archive and returns them. The archive is written first, so a failure
+// to save the list afterwards leaves todos in both places rather than in
+// neither.
+func archiveTodos(list string, todos *Todos, cutoff time.Time) (Todos, error) {
+	removed := todos.removeWhere(func(t Todo) bool {
+		return t.isClosed() && t.closedAt().Before(cutoff)
+	})
+	if len(removed) == 0 {
+		return nil, nil
+	}
+
+	var opts []StorageOption
+	if listEncrypted(list) {
+		opts = append(opts, WithEncryption(passphrases))
+	}
+	if err := os.MkdirAll(listArchiveDir(list), 0755); err != nil {
+		return nil, err
+	}
+
+	now := clock()
+	months := map[string][]archivedTodo{}
+	for _, t := range removed {
+		month := local(t.closedAt()).Format(archiveMonthFormat)
+		months[month] = append(months[month], archivedTodo{Todo: t, ArchivedAt: now})
+	}
+	for month, added := range months {
+		storage := newArchiveStorage(filepath.Join(listArchiveDir(list), month+".json"), opts...)
+		var entries []archivedTodo
+		if err := storage.Load(&entries); err != nil {
+			return nil, err
+		}
+		// A todo archived again, say after an undo, replaces its old copy.
+		entries = slices.DeleteFunc(entries, func(e archivedTodo) bool {
+			return slices.ContainsFunc(added, func(a archivedTodo) bool { return a.ID == e.ID })
+		})
+		if err := storage.Save(append(entries, added...)); err != nil {
+			return nil, err
+		}
+	}
+	return removed, nil
+}
+
+// autoArchive applies the configured archive policy to the todos of list.
+func autoArchive(list string, todos *Todos) error {
+	if global.config.Archive.After == "" {
+		return nil
+	}
+	age, err := parseAge(global.config.Archive.After)
+	if err != nil {
+		return err
+	}
+	archived, err := archiveTodos(list, todos, clock().Add(-age))
+	if err != nil {
+		return err
+	}
+	if len(archived) > 0 {
+		fmt.Fprintf(os.Stderr, "Archived %d todo(s) closed more than %s ago\n", len(archived), global.config.Archive.After)
+	}
+	return nil
+}
+
+// loadArchive returns everything archived for list.
+func loadArchive(list string) ([]archivedTodo, error) {
+	files, err := archiveFiles(list)
+	if err != nil {
+		return nil, err
+	}
+	var all []archivedTodo
+	for _, f := range files {
+		var entries []archivedTodo
+		if err := newArchiveStorage(f).Peek(&entries); err != nil {
+			return nil, err
+		}
+		all = append(all, entries...)
+	}
+	return all, nil
+}
+
+// restoreTodos copies the todos with the given IDs from the archive of list
+// back into todos. Subtasks whose parent isn't in the list any more become
+// top level todos. The archive is left as it is: callers save the list
+// first and then call unarchive, so a failure in between leaves todos in
+// both places rather than in neither.
+func restoreTodos(list string, todos *Todos, ids []string) (Todos, error) {
+	want := map[string]bool{}
+	for _, id := range ids {
+		id = normalizeID(id)
+		if _, err := todos.indexOf(id); err == nil {
+			return nil, fmt.Errorf("%s is already in the list", id)
+		}
+		want[id] = true
+	}
+
+	archived, err := loadArchive(list)
+	if err != nil {
+		return nil, err
+	}
+	var restored Todos
+	for _, e := range archived {
+		if want[e.ID] {
+			restored = append(restored, e.Todo)
+			delete(want, e.ID)
+		}
+	}
+	for id := range want {
+		return nil, fmt.Errorf("%w in the archive: %q", ErrNotFound, id)
+	}
+
+	*todos = append(*todos, restored...)
+	for i := len(*todos) - len(restored); i < len(*todos); i++ {
+		if _, err := todos.indexOf((*todos)[i].ParentID); err != nil {
+			(*todos)[i].ParentID = ""
+		}
+	}
+	todos.dropBlockers()
+	return restored, nil
+}
+
+// unarchive removes the entries with the given IDs from the archive of
+// list, but only those whose todo is back in todos, so nothing is dropped
+// that isn't stored elsewhere.
+func unarchive(list string, todos Todos, ids []string) error {
+	drop := map[string]bool{}
+	for _, id := range ids {
+		if _, err := todos.indexOf(id); err == nil {
+			drop[normalizeID(id)] = true
+		}
+	}
+	files, err := archiveFiles(list)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		storage := newArchiveStorage(f)
+		var entries []archivedTodo
+		if err := storage.Load(&entries); err != nil {
+			return err
+		}
+		kept := slices.DeleteFunc(slices.Clone(entries), func(e archivedTodo) bool { return drop[e.ID] })
+		switch {
+		case len(kept) == len(entries):
+			continue
+		case len(kept) == 0:
+			err = os.Remove(f)
+		default:
+			err = storage.Save(kept)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cmdArchive() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("archive", "[search|restore] [ARGS...]", "Move closed todos out of the list into its archive, one file per month\n"+
+		"they were closed in. Use a subcommand to search or restore archived todos.")
+	olderThan := fs.String("older-than", "", "only archive todos closed longer ago than this, e.g. 14d, 2w or 36h")
+	dryRun := fs.Bool("dry-run", false, "show what would be archived without archiving it")
+	return fs, func(rest []string) error {
+		if len(rest) > 0 {
+			return usagef("unknown subcommand %q", rest[0])
+		}
+		cutoff := clock()
+		if *olderThan != "" {
+			age, err := parseAge(*olderThan)
+			if err != nil {
+				return usagef("%v", err)
+			}
+			cutoff = cutoff.Add(-age)
+		}
+
+		name, err := activeList()
+		if err != nil {
+			return err
+		}
+		// The archive isn't part of the undo history, so neither is archiving;
+		// "archive restore" takes todos back.
+		return withStoreFile(listFile(name), !*dryRun, func(todos *Todos, _ *History) error {
+			if *dryRun {
+				for _, t := range *todos {
+					if t.isClosed() && t.closedAt().Before(cutoff) {
+						fmt.Printf("Would archive %s %s\n", t.ID, t.Title)
+					}
+				}
+				return nil
+			}
+			archived, err := archiveTodos(name, todos, cutoff)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Archived %d todo(s)\n", len(archived))
+			return nil
+		})
+	}
+}
+
+func archiveSearch() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("archive search", "[TEXT...]", "List archived todos whose title contains TEXT, most recently closed first.")
+	tag := fs.String("tag", "", "only show todos with this tag")
+	from := fs.String("from", "", "only show todos closed on or after this day")
+	to := fs.String("to", "", "only show todos closed on or before this day")
+	output := fs.String("output", "table", "output format: table or json")
+	ascii := fs.Bool("ascii", false, "use plain ASCII box drawing characters")
+	return fs, func(rest []string) error {
+		var err error
+		if !slices.Contains([]string{"table", "json"}, *output) {
+			return usagef("invalid output format %q (want table or json)", *output)
+		}
+		var start, end time.Time
+		if *from != "" {
+			if start, err = parseDay(*from); err != nil {
+				return usagef("--from: %v", err)
+			}
+		}
+		if *to != "" {
+			if end, err = parseDay(*to); err != nil {
+				return usagef("--to: %v", err)
+			}
+			end = end.AddDate(0, 0, 1)
+		}
+		text := strings.ToLower(joinArgs(rest))
+
+		name, err := activeList()
+		if err != nil {
+			return err
+		}
+		var rows []archivedTodo
+		// Archives change under the list's lock.
+		err = withStoreFile(listFile(name), false, func(*Todos, *History) error {
+			all, err := loadArchive(name)
+			if err != nil {
+				return err
+			}
+			for _, e := range all {
+				closed := e.closedAt()
+				switch {
+				case text != "" && !strings.Contains(strings.ToLower(e.Title), text):
+				case *tag != "" && !e.hasTag(*tag):
+				case !start.IsZero() && closed.Before(start):
+				case !end.IsZero() && !closed.Before(end):
+				default:
+					rows = append(rows, e)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		sort.SliceStable(rows, func(i, j int) bool { return rows[i].closedAt().After(rows[j].closedAt()) })
+
+		if *output == "json" {
+			if rows == nil {
+				rows = []archivedTodo{}
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "    ")
+			return enc.Encode(rows)
+		}
+		if len(rows) == 0 {
+			fmt.Println("No archived todos found")
+			return nil
+		}
+		tbl := table.New(os.Stdout)
+		if *ascii {
+			tbl.SetDividers(table.ASCIIDividers)
+		}
+		tbl.SetRowLines(false)
+		tbl.SetHeaders("ID", "Title", "Status", "Closed", "Archived", "Tags")
+		for _, e := range rows {
+			tbl.AddRow(e.ID, e.Title, string(e.status()), local(e.closedAt()).Format(dueFormat), local(e.ArchivedAt).Format(dayFormat), strings.Join(e.Tags, ", "))
+		}
+		tbl.Render()
+		return nil
+	}
+}
+
+func archiveRestore() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("archive restore", "ID...", "Move archived todos back into the list. Todos restored closed are\n"+
+		"archived again by the configured archive policy unless reopened.")
+	reopen := fs.Bool("reopen", false, "also set the restored todos back to todo")
+	return fs, func(rest []string) error {
+		if len(rest) == 0 {
+			return usagef("expected at least one ID")
+		}
+
+		name, err := activeList()
+		if err != nil {
+			return err
+		}
+		// Like archiving, restoring bypasses the undo history and the automatic
+		// archive policy, which would otherwise take old closed todos straight
+		// back.
+		var restored Todos
+		err = withStoreFile(listFile(name), true, func(todos *Todos, _ *History) error {
+			restored, err = restoreTodos(name, todos, rest)
+			if err != nil {
+				return err
+			}
+			if *reopen {
+				for _, t := range restored {
+					index, _ := todos.indexOf(t.ID)
+					todos.setStatus(index, StatusTodo)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// The list is saved; only now can the archived copies go.
+		err = withStoreFile(listFile(name), false, func(todos *Todos, _ *History) error {
+			return unarchive(name, *todos, rest)
+		})
+		if err != nil {
+			return err
+		}
+		for _, t := range restored {
+			fmt.Printf("Restored %s %s\n", t.ID, t.Title)
+		}
+		return nil
+	}
+}
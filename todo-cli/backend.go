@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// Backend persists the serialized form of a Storage value.
+type Backend interface {
+	// Read returns the most recently written payload. If nothing has been
+	// written yet the error satisfies errors.Is(err, fs.ErrNotExist).
+	Read() ([]byte, error)
+	// Write replaces the stored payload with data.
+	Write(data []byte) error
+}
+
+// fileLocker is implemented by backends that can serialize access across
+// processes.
+type fileLocker interface {
+	Lock(exclusive bool) (unlock func() error, err error)
+}
+
+// backupper is implemented by backends that can keep a copy of data that is
+// about to be replaced by a schema migration.
+type backupper interface {
+	Backup(suffix string, data []byte) error
+}
+
+// backupFile writes data to fileName+suffix unless that backup already
+// exists, so the oldest copy is never overwritten.
+func backupFile(fileName, suffix string, data []byte) error {
+	name := fileName + suffix
+	if _, err := os.Stat(name); err == nil {
+		return nil
+	}
+	return writeFileAtomic(name, data, 0600)
+}
+
+// JSONFileBackend stores the payload as a single JSON file that is replaced
+// atomically on every write.
+type JSONFileBackend struct {
+	FileName string
+}
+
+func NewJSONFileBackend(fileName string) *JSONFileBackend {
+	return &JSONFileBackend{FileName: fileName}
+}
+
+func (b *JSONFileBackend) Read() ([]byte, error) {
+	return os.ReadFile(b.FileName)
+}
+
+func (b *JSONFileBackend) Write(data []byte) error {
+	return writeFileAtomic(b.FileName, data, 0644)
+}
+
+func (b *JSONFileBackend) Backup(suffix string, data []byte) error {
+	return backupFile(b.FileName, suffix, data)
+}
+
+func (b *JSONFileBackend) Lock(exclusive bool) (func() error, error) {
+	return lockFile(b.FileName+".lock", exclusive)
+}
+
+// JournalBackend appends every payload as one compact JSON line and reads
+// back the last complete line. Older versions stay in the file as history.
+type JournalBackend struct {
+	FileName string
+}
+
+func NewJournalBackend(fileName string) *JournalBackend {
+	return &JournalBackend{FileName: fileName}
+}
+
+func (b *JournalBackend) Read() ([]byte, error) {
+	f, err := os.Open(b.FileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var last []byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		// A crash during an append can leave a truncated last line; keep
+		// the previous complete entry in that case.
+		if len(line) == 0 || !json.Valid(line) {
+			continue
+		}
+		last = append(last[:0], line...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if last == nil {
+		return nil, fs.ErrNotExist
+	}
+	return last, nil
+}
+
+func (b *JournalBackend) Write(data []byte) error {
+	var line bytes.Buffer
+	if err := json.Compact(&line, data); err != nil {
+		return err
+	}
+	line.WriteByte('\n')
+	entry := line.Bytes()
+
+	f, err := os.OpenFile(b.FileName, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	// Finish a line torn by a crash, so the new entry doesn't run into
+	// it and get skipped too.
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			entry = append([]byte{'\n'}, entry...)
+		}
+	}
+	if _, err := f.Write(entry); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (b *JournalBackend) Backup(suffix string, data []byte) error {
+	return backupFile(b.FileName, suffix, data)
+}
+
+func (b *JournalBackend) Lock(exclusive bool) (func() error, error) {
+	return lockFile(b.FileName+".lock", exclusive)
+}
+
+// MemoryBackend keeps the payload in memory. It is meant for tests and for
+// callers that don't want anything written to disk.
+type MemoryBackend struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{}
+}
+
+func (b *MemoryBackend) Read() ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.data == nil {
+		return nil, fs.ErrNotExist
+	}
+	return bytes.Clone(b.data), nil
+}
+
+func (b *MemoryBackend) Write(data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.data = bytes.Clone(data)
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackendRoundTrip(t *testing.T) {
+	backends := map[string]func(fileName string) Backend{
+		"json file": func(name string) Backend { return NewJSONFileBackend(name) },
+		"journal":   func(name string) Backend { return NewJournalBackend(name) },
+		"memory":    func(string) Backend { return NewMemoryBackend() },
+	}
+	for name, newBackend := range backends {
+		t.Run(name, func(t *testing.T) {
+			b := newBackend(filepath.Join(t.TempDir(), "todos.json"))
+			if _, err := b.Read(); !errors.Is(err, fs.ErrNotExist) {
+				t.Fatalf("Read before any Write = %v, want %v", err, fs.ErrNotExist)
+			}
+			for _, data := range []string{`{"version":2,"data":[]}`, `{"version":2,"data":[{"id":"a2b3"}]}`} {
+				if err := b.Write([]byte(data)); err != nil {
+					t.Fatal(err)
+				}
+				got, err := b.Read()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != data {
+					t.Errorf("Read = %s, want %s", got, data)
+				}
+			}
+		})
+	}
+}
+
+func TestJournalKeepsHistory(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "todos.jsonl")
+	b := NewJournalBackend(file)
+	for _, data := range []string{"{\n  \"n\": 1\n}", `{"n": 2}`, `{"n":3}`} {
+		if err := b.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Every entry is compacted onto a line of its own; Read replays to the
+	// last one.
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\"n\":1}\n{\"n\":2}\n{\"n\":3}\n"; string(content) != want {
+		t.Errorf("journal =\n%s\nwant\n%s", content, want)
+	}
+	if got, _ := b.Read(); string(got) != `{"n":3}` {
+		t.Errorf("Read = %s, want the last entry", got)
+	}
+}
+
+func TestJournalTornLastLine(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "todos.jsonl")
+	b := NewJournalBackend(file)
+	for _, data := range []string{`{"n":1}`, `{"n":2}`} {
+		if err := b.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A crash in the middle of an append.
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"version":2,"da`)
+	f.Close()
+
+	got, err := b.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `{"n":2}` {
+		t.Errorf("Read = %s, want the last complete entry", got)
+	}
+
+	if err := b.Write([]byte(`{"n":3}`)); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := b.Read(); string(got) != `{"n":3}` {
+		t.Errorf("Read after the next Write = %s, want it", got)
+	}
+}
+
+func TestStorageBackends(t *testing.T) {
+	usePassphrase(t, "secret")
+	todos := Todos{{ID: "a2b3", Title: "report", Status: StatusTodo}}
+
+	tests := []struct {
+		name string
+		opts []StorageOption
+	}{
+		{"journal", []StorageOption{WithJournal()}},
+		{"encrypted journal", []StorageOption{WithJournal(), WithEncryption(passphrases)}},
+		{"memory", []StorageOption{WithMemory()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "todos.jsonl")
+			store := newTodoStorage(file, tt.opts...)
+			if err := store.Save(todos); err != nil {
+				t.Fatal(err)
+			}
+			var got Todos
+			if err := store.Load(&got); err != nil {
+				t.Fatal(err)
+			}
+			if !sameTodoList(got, todos) {
+				t.Errorf("Load = %+v, want %+v", got, todos)
+			}
+
+			content, _ := os.ReadFile(file)
+			if bytes.Contains(content, []byte("report")) != (tt.name == "journal") {
+				t.Errorf("%s on disk:\n%s", file, content)
+			}
+		})
+	}
+}
@@ -0,0 +1,628 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// dueFormat is used to print due dates.
+const dueFormat = "2006-01-02 15:04"
+
+// parseDue parses a due date given on the command line, see parseWhen. A
+// date without a time of day means the end of that day. An empty string
+// means no due date.
+func parseDue(s string) (*time.Time, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	t, hasTime, err := parseWhen(s, local(clock()))
+	if err != nil {
+		return nil, err
+	}
+	if !hasTime {
+		t = t.AddDate(0, 0, 1).Add(-time.Second)
+	}
+	return &t, nil
+}
+
+// dayFormat is used to parse and print calendar days.
+const dayFormat = "2006-01-02"
+
+// parseDay parses a day given on the command line, see parseWhen, and
+// returns the start of that day in local time.
+func parseDay(s string) (time.Time, error) {
+	t, _, err := parseWhen(s, local(clock()))
+	if err != nil {
+		return time.Time{}, err
+	}
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location()), nil
+}
+
+// colorEnabled reports whether colored output should be written to f,
+// following the color setting. In auto mode it honors the NO_COLOR
+// convention (https://no-color.org).
+func colorEnabled(f *os.File) bool {
+	switch global.config.Color {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// stringList is a flag.Value collecting every occurrence of a flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// flagsSet returns the names of the flags given on the command line.
+func flagsSet(fs *flag.FlagSet) map[string]bool {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+// withTodos loads the todo list and passes it to fn. When op is not empty
+// fn is a mutation: the result is written back to storage and recorded
+// under the name op in the undo history.
+func withTodos(op string, fn func(todos *Todos) error) error {
+	return withStore(op != "", func(todos *Todos, history *History) error {
+		before := cloneTodos(*todos)
+		if err := fn(todos); err != nil {
+			return err
+		}
+		if op != "" {
+			todos.stamp(before, clock())
+			history.record(op, before, *todos)
+		}
+		return nil
+	})
+}
+
+// withStore loads the selected todo list and its undo history, passes both
+// to fn and, when save is true, writes both back. Saving also applies the
+// configured archive policy.
+func withStore(save bool, fn func(todos *Todos, history *History) error) error {
+	name, err := activeList()
+	if err != nil {
+		return err
+	}
+	return withStoreFile(listFile(name), save, func(todos *Todos, history *History) error {
+		if err := fn(todos, history); err != nil {
+			return err
+		}
+		if save {
+			return autoArchive(name, todos)
+		}
+		return nil
+	})
+}
+
+// withStoreFile is withStore for the list stored in todoFile. The storage
+// lock is held for the whole call, so parallel invocations serialize instead
+// of losing changes.
+func withStoreFile(todoFile string, save bool, fn func(todos *Todos, history *History) error) (err error) {
+	todos := Todos{}
+	history := History{}
+	storage := newTodoStorage(todoFile)
+
+	// The lock file goes next to the list, so the data directory must
+	// exist even for a first read.
+	if err := os.MkdirAll(filepath.Dir(todoFile), 0755); err != nil {
+		return err
+	}
+	// Load writes back migrated data, so even read-only commands take the
+	// exclusive lock.
+	unlock, err := storage.Lock()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if uerr := unlock(); err == nil {
+			err = uerr
+		}
+	}()
+
+	if err := storage.Load(&todos); err != nil {
+		return err
+	}
+	// The history holds copies of todos, so it is encrypted with the list.
+	var opts []StorageOption
+	if storage.Encrypted() {
+		opts = append(opts, WithEncryption(passphrases))
+	}
+	historyStorage := newHistoryStorage(historyFile(todoFile), opts...)
+	if err := historyStorage.Load(&history); err != nil {
+		return err
+	}
+	if err := fn(&todos, &history); err != nil {
+		return err
+	}
+	if !save {
+		return nil
+	}
+	if err := storage.Save(todos); err != nil {
+		return err
+	}
+	return historyStorage.Save(history)
+}
+
+// viewStoreFile passes the list stored in todoFile to fn for reading. It
+// takes the shared lock and doesn't upgrade older data on disk, so listing
+// never changes files. A missing file is an empty list.
+func viewStoreFile(todoFile string, fn func(todos Todos) error) (err error) {
+	todos := Todos{}
+	if _, err := os.Stat(todoFile); errors.Is(err, os.ErrNotExist) {
+		return fn(todos)
+	}
+	storage := newTodoStorage(todoFile)
+	unlock, err := storage.RLock()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if uerr := unlock(); err == nil {
+			err = uerr
+		}
+	}()
+
+	if err := storage.Peek(&todos); err != nil {
+		return err
+	}
+	return fn(todos)
+}
+
+func cmdAdd() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("add", "TITLE...", "Add a new todo.")
+	due := fs.String("due", "", "due date, "+dateHelp)
+	priority := fs.String("priority", "", "priority: low, medium or high")
+	var tags stringList
+	fs.Var(&tags, "tag", "tag to attach (repeatable, or comma separated)")
+	repeat := fs.String("repeat", "", "repeat rule: daily[:N], weekly[:N|:mon,...], monthly[:DAY|:last] or after:N")
+	parent := fs.String("parent", "", "ID of the todo this one is a subtask of")
+	var blockers stringList
+	fs.Var(&blockers, "blocked-by", "ID of a todo that must be done first (repeatable)")
+	return fs, func(rest []string) error {
+		var err error
+		title := joinArgs(rest)
+		if title == "" {
+			return usagef("a title is required")
+		}
+
+		todo := Todo{Title: title, Tags: normalizeTags(tags)}
+		if todo.Due, err = parseDue(*due); err != nil {
+			return usagef("%v", err)
+		}
+		if todo.Priority, err = parsePriority(*priority); err != nil {
+			return usagef("%v", err)
+		}
+		if todo.Recur, err = parseRecurrence(*repeat); err != nil {
+			return usagef("%v", err)
+		}
+		if todo.Recur != nil {
+			todo.Recur.anchor(todo.Due)
+		}
+
+		return withTodos("add", func(todos *Todos) error {
+			if *parent != "" {
+				index, err := todos.indexOf(*parent)
+				if err != nil {
+					return err
+				}
+				todo.ParentID = (*todos)[index].ID
+			}
+			id := todos.addTodo(todo)
+			for _, blocker := range blockers {
+				if err := todos.addBlocker(id, blocker); err != nil {
+					return err
+				}
+			}
+			fmt.Printf("Added %s\n", id)
+			return nil
+		})
+	}
+}
+
+func cmdList() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("list", "", "Print all todos.")
+	var opts listOptions
+	fs.StringVar(&opts.Tag, "tag", "", "only show todos with this tag")
+	priority := fs.String("priority", "", "only show todos with this priority")
+	status := fs.String("status", "", "only show todos with this status")
+	fs.BoolVar(&opts.Overdue, "overdue", false, "only show open todos past their due date")
+	fs.StringVar(&opts.SortBy, "sort", "", "sort by due, priority or created")
+	fs.BoolVar(&opts.Kanban, "kanban", false, "show one column per status")
+	fs.BoolVar(&opts.HideBlocked, "hide-blocked", false, "leave out todos whose blockers are still open")
+	fs.StringVar(&opts.Output, "output", "table", "output format: "+strings.Join(outputFormats, ", "))
+	fs.BoolVar(&opts.ASCII, "ascii", false, "use plain ASCII instead of emoji and box drawing characters")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	fs.StringVar(&opts.TimeFormat, "time-format", global.config.TimeFormat, "time format: rfc1123, rfc3339, iso, date, kitchen or a Go layout")
+	format := fs.String("format", "", "Go text/template to print the todos with, or a preset: "+strings.Join(formatNames(), ", "))
+	return fs, func(rest []string) error {
+		var err error
+		if len(rest) > 0 {
+			return usagef("unexpected arguments: %v", rest)
+		}
+		if !slices.Contains(outputFormats, opts.Output) {
+			return usagef("invalid output format %q (want %s)", opts.Output, strings.Join(outputFormats, ", "))
+		}
+		opts.Color = !*noColor && colorEnabled(os.Stdout)
+		if opts.Priority, err = parsePriority(*priority); err != nil {
+			return usagef("%v", err)
+		}
+		if !slices.Contains(sortKeys, opts.SortBy) {
+			return usagef("invalid sort key %q (want due, priority or created)", opts.SortBy)
+		}
+		if *status != "" {
+			if opts.Status, err = parseStatus(*status); err != nil {
+				return usagef("%v", err)
+			}
+		}
+		if *format != "" {
+			if opts.Template, err = parseFormat(*format, opts); err != nil {
+				return usagef("%v", err)
+			}
+		}
+
+		return withTodos("", func(todos *Todos) error {
+			return todos.print(os.Stdout, opts)
+		})
+	}
+}
+
+func cmdToggle() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("toggle", "ID", "Mark a todo as done, or a done todo back to todo.")
+	cascade := fs.Bool("cascade", false, "give all subtasks the same state")
+	force := fs.Bool("force", false, "complete the todo even if its blockers are open")
+	return fs, func(rest []string) error {
+		if len(rest) != 1 {
+			return usagef("expected exactly one ID")
+		}
+		id := rest[0]
+
+		return withTodos("toggle", func(todos *Todos) error {
+			return todos.toggle(id, *cascade, *force)
+		})
+	}
+}
+
+func cmdStatus() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("status", "ID STATUS", "Move a todo to another workflow status.")
+	force := fs.Bool("force", false, "mark the todo done even if its blockers are open")
+	return fs, func(rest []string) error {
+		if len(rest) != 2 {
+			return usagef("expected an ID and a status")
+		}
+		id := rest[0]
+		status, err := parseStatus(rest[1])
+		if err != nil {
+			return usagef("%v", err)
+		}
+
+		return withTodos("status", func(todos *Todos) error {
+			index, err := todos.indexOf(id)
+			if err != nil {
+				return err
+			}
+			if status == StatusDone && !*force {
+				if err := todos.checkBlockers(index); err != nil {
+					return err
+				}
+			}
+			return todos.changeStatus(index, status)
+		})
+	}
+}
+
+func cmdEdit() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("edit", "ID [TITLE...]", "Change the title or details of a todo.")
+	due := fs.String("due", "", "new due date ("+dateHelp+"), or \"none\" to clear it")
+	priority := fs.String("priority", "", "new priority: low, medium, high or none")
+	var tags, untags stringList
+	fs.Var(&tags, "tag", "tag to add (repeatable)")
+	fs.Var(&untags, "untag", "tag to remove (repeatable)")
+	repeat := fs.String("repeat", "", "new repeat rule, or \"none\" to stop repeating")
+	parent := fs.String("parent", "", "ID of the new parent todo, or \"none\" to make it top level")
+	var blockers, unblocks stringList
+	fs.Var(&blockers, "blocked-by", "ID of a todo that must be done first (repeatable)")
+	fs.Var(&unblocks, "unblock", "ID of a todo to no longer wait for (repeatable)")
+	return fs, func(rest []string) error {
+		var err error
+		if len(rest) < 1 {
+			return usagef("expected an ID")
+		}
+		id := rest[0]
+		title := joinArgs(rest[1:])
+
+		set := flagsSet(fs)
+		if title == "" && len(set) == 0 {
+			return usagef("nothing to change: give a new title or flags")
+		}
+		var newDue *time.Time
+		if set["due"] && *due != "none" {
+			if newDue, err = parseDue(*due); err != nil {
+				return usagef("%v", err)
+			}
+		}
+		newPriority, err := parsePriority(*priority)
+		if err != nil {
+			return usagef("%v", err)
+		}
+		newRecur, err := parseRecurrence(*repeat)
+		if err != nil {
+			return usagef("%v", err)
+		}
+
+		return withTodos("edit", func(todos *Todos) error {
+			if set["parent"] {
+				parentID := *parent
+				if parentID == "none" {
+					parentID = ""
+				}
+				if err := todos.setParent(id, parentID); err != nil {
+					return err
+				}
+			}
+			for _, blocker := range unblocks {
+				if err := todos.removeBlocker(id, blocker); err != nil {
+					return err
+				}
+			}
+			for _, blocker := range blockers {
+				if err := todos.addBlocker(id, blocker); err != nil {
+					return err
+				}
+			}
+			return todos.update(id, func(t *Todo) error {
+				if title != "" {
+					t.Title = title
+				}
+				if set["due"] {
+					t.Due = newDue
+				}
+				if set["priority"] {
+					t.Priority = newPriority
+				}
+				if set["repeat"] {
+					t.Recur = newRecur
+				}
+				if t.Recur != nil {
+					t.Recur.anchor(t.Due)
+				}
+				t.Tags = normalizeTags(append(t.Tags, tags...))
+				for _, tag := range normalizeTags(untags) {
+					t.Tags = slices.DeleteFunc(t.Tags, func(s string) bool { return s == tag })
+				}
+				return nil
+			})
+		})
+	}
+}
+
+func cmdSnooze() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("snooze", "ID [WHEN...]", "Move the due date of a todo to WHEN, "+dateHelp+". It defaults to tomorrow.")
+	return fs, func(rest []string) error {
+		if len(rest) < 1 {
+			return usagef("expected an ID")
+		}
+		id := rest[0]
+		when := joinArgs(rest[1:])
+		if when == "" {
+			when = "tomorrow"
+		}
+		due, err := parseDue(when)
+		if err != nil {
+			return usagef("%v", err)
+		}
+
+		return withTodos("snooze", func(todos *Todos) error {
+			return todos.update(id, func(t *Todo) error {
+				t.Due = due
+				fmt.Printf("Snoozed %s until %s\n", t.ID, local(*due).Format(dueFormat))
+				return nil
+			})
+		})
+	}
+}
+
+func cmdDelete() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("delete", "ID", "Remove a todo.")
+	orphans := fs.String("orphans", "reparent", "what to do with subtasks: reparent (move them up) or cascade (delete them)")
+	return fs, func(rest []string) error {
+		policy, err := parseOrphanPolicy(*orphans)
+		if err != nil {
+			return usagef("%v", err)
+		}
+		if len(rest) != 1 {
+			return usagef("expected exactly one ID")
+		}
+		id := rest[0]
+
+		return withTodos("delete", func(todos *Todos) error {
+			return todos.delete(id, policy)
+		})
+	}
+}
+
+func cmdClearCompleted() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("clear-completed", "", "Remove all completed todos.")
+	return fs, func(rest []string) error {
+		if len(rest) > 0 {
+			return usagef("unexpected arguments: %v", rest)
+		}
+
+		return withTodos("clear-completed", func(todos *Todos) error {
+			removed := todos.clearCompleted()
+			fmt.Printf("Removed %d completed todo(s)\n", removed)
+			return nil
+		})
+	}
+}
+
+// exchangeFormat resolves the --format flag, falling back to the extension
+// of fileName.
+func exchangeFormat(format, fileName string) (string, error) {
+	if format == "" {
+		detected, ok := detectFormat(fileName)
+		if !ok {
+			return "", usagef("cannot detect the format of %q; use --format", fileName)
+		}
+		return detected, nil
+	}
+	if format == "md" {
+		format = "markdown"
+	}
+	if !slices.Contains(exchangeFormats, format) {
+		return "", usagef("invalid format %q (want %s)", format, strings.Join(exchangeFormats, ", "))
+	}
+	return format, nil
+}
+
+func cmdExport() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("export", "[FILE]", "Write all todos to FILE, or to standard output.")
+	format := fs.String("format", "", "csv, markdown or todotxt (default: from the file extension)")
+	return fs, func(rest []string) error {
+		var err error
+		if len(rest) > 1 {
+			return usagef("expected at most one file")
+		}
+		fileName := ""
+		if len(rest) == 1 && rest[0] != "-" {
+			fileName = rest[0]
+		}
+		if fileName == "" && *format == "" {
+			return usagef("--format is required when writing to standard output")
+		}
+		if *format, err = exchangeFormat(*format, fileName); err != nil {
+			return err
+		}
+
+		return withTodos("", func(todos *Todos) error {
+			if fileName == "" {
+				return exportTodos(os.Stdout, *format, *todos)
+			}
+			var buf bytes.Buffer
+			if err := exportTodos(&buf, *format, *todos); err != nil {
+				return err
+			}
+			return writeFileAtomic(fileName, buf.Bytes(), 0644)
+		})
+	}
+}
+
+func cmdImport() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("import", "FILE", "Add the todos in FILE (\"-\" for standard input) to the list.")
+	format := fs.String("format", "", "csv, markdown or todotxt (default: from the file extension)")
+	return fs, func(rest []string) error {
+		var err error
+		if len(rest) != 1 {
+			return usagef("expected exactly one file")
+		}
+		fileName := rest[0]
+		if fileName == "-" && *format == "" {
+			return usagef("--format is required when reading standard input")
+		}
+		if *format, err = exchangeFormat(*format, fileName); err != nil {
+			return err
+		}
+
+		var in io.Reader = os.Stdin
+		if fileName != "-" {
+			f, err := os.Open(fileName)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+		imported, err := importTodos(in, *format)
+		if err != nil {
+			return fmt.Errorf("importing %s: %w", fileName, err)
+		}
+
+		return withTodos("import", func(todos *Todos) error {
+			fmt.Printf("Imported %d todo(s)\n", todos.merge(imported))
+			return nil
+		})
+	}
+}
+
+func cmdUndo() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("undo", "", "Revert the last change to the todo list.")
+	return undoRedo(fs, "Undone", (*History).undo)
+}
+
+func cmdRedo() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("redo", "", "Reapply the last undone change.")
+	return undoRedo(fs, "Redone", (*History).redo)
+}
+
+func undoRedo(fs *flag.FlagSet, done string, step func(*History, *Todos) (operation, error)) (*flag.FlagSet, func(args []string) error) {
+	steps := fs.Int("n", 1, "number of operations")
+	return fs, func(rest []string) error {
+		if len(rest) > 0 {
+			return usagef("unexpected arguments: %v", rest)
+		}
+		if *steps < 1 {
+			return usagef("-n must be at least 1")
+		}
+
+		return withStore(true, func(todos *Todos, history *History) error {
+			// Undoing or redoing is a change of its own: the todos it puts
+			// back must win the next merge over what the other side had.
+			before := cloneTodos(*todos)
+			defer todos.stamp(before, clock())
+			for i := 0; i < *steps; i++ {
+				op, err := step(history, todos)
+				if err != nil {
+					// Stop quietly once the history runs out part way.
+					if i > 0 {
+						break
+					}
+					return err
+				}
+				fmt.Printf("%s: %s (%s)\n", done, op.Name, local(op.At).Format(time.RFC1123))
+			}
+			return nil
+		})
+	}
+}
+
+func cmdHistory() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("history", "", "Show the operations that can be undone.")
+	return fs, func(rest []string) error {
+		if len(rest) > 0 {
+			return usagef("unexpected arguments: %v", rest)
+		}
+
+		return withStore(false, func(todos *Todos, history *History) error {
+			for i := len(history.Undo) - 1; i >= 0; i-- {
+				op := history.Undo[i]
+				fmt.Printf("%s  %-16s %d todo(s)\n", local(op.At).Format(time.RFC1123), op.Name, len(op.Changes))
+			}
+			return nil
+		})
+	}
+}
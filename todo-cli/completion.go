@@ -0,0 +1,464 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// completeFilesDirective is printed by __complete, instead of candidates,
+// when the shell should complete file names itself.
+const completeFilesDirective = ":files"
+
+// candidate is one completion with an optional description.
+type candidate struct {
+	value string
+	desc  string
+}
+
+// argKinds says what the positional arguments of a command or subcommand
+// are. A kind ending in "..." repeats.
+var argKinds = map[string][]string{
+	"toggle":          {"open-id"},
+	"status":          {"open-id", "status"},
+	"start":           {"open-id"},
+	"snooze":          {"open-id"},
+	"edit":            {"id"},
+	"delete":          {"id"},
+	"export":          {"file"},
+	"import":          {"file"},
+	"merge":           {"file", "file", "file"},
+	"completion":      {"shell"},
+	"lists switch":    {"list"},
+	"lists rename":    {"list"},
+	"lists delete":    {"list"},
+	"archive restore": {"archived-id..."},
+}
+
+// flagKinds says what the values of flags are, by flag name. Keys with a
+// command name in front win over plain flag names.
+var flagKinds = map[string]string{
+	"list":                  "list",
+	"data-dir":              "file",
+	"color":                 "color",
+	"priority":              "priority",
+	"status":                "status",
+	"sort":                  "sort",
+	"parent":                "open-id",
+	"blocked-by":            "open-id",
+	"unblock":               "id",
+	"tag":                   "tag",
+	"untag":                 "tag",
+	"orphans":               "orphans",
+	"by":                    "by",
+	"time-format":           "time-format",
+	"list format":           "template",
+	"export format":         "exchange",
+	"import format":         "exchange",
+	"merge o":               "file",
+	"list output":           "list-output",
+	"all output":            "table-output",
+	"archive search output": "table-output",
+	"stats output":          "text-output",
+	"config output":         "text-output",
+}
+
+// takesValue reports whether the flag word w needs the next word as its
+// value.
+func takesValue(fs *flag.FlagSet, w string) (*flag.Flag, bool) {
+	name := strings.TrimLeft(w, "-")
+	if strings.Contains(name, "=") {
+		return nil, false
+	}
+	f := fs.Lookup(name)
+	if f == nil {
+		return nil, false
+	}
+	if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+		return f, false
+	}
+	return f, true
+}
+
+// scanArgs walks the words after a command name the way parseArgs does. It
+// returns the positional arguments and the flag still waiting for its value
+// at the end, if any.
+func scanArgs(fs *flag.FlagSet, words []string) (positional []string, pending *flag.Flag, dashDash bool) {
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		switch {
+		case dashDash || w == "-" || !strings.HasPrefix(w, "-"):
+			positional = append(positional, w)
+		case w == "--":
+			dashDash = true
+		default:
+			if f, ok := takesValue(fs, w); ok {
+				if i+1 == len(words) {
+					return positional, f, false
+				}
+				i++
+			}
+		}
+	}
+	return positional, nil, dashDash
+}
+
+// completeWords returns the completions for the last of words, which is the
+// command line up to the cursor without the program name. files is true
+// when file names should be completed instead.
+func completeWords(words []string) (cands []candidate, files bool) {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur, prev := words[len(words)-1], words[:len(words)-1]
+	applyListFlags(words)
+
+	// Global flags come before the command name.
+	gfs := flag.NewFlagSet(programName, flag.ContinueOnError)
+	addGlobalFlags(gfs)
+	i := 0
+	for i < len(prev) && strings.HasPrefix(prev[i], "-") && prev[i] != "-" && prev[i] != "--" {
+		f, ok := takesValue(gfs, prev[i])
+		i++
+		if ok {
+			if i == len(prev) {
+				return completeValues("", flagKind("", f.Name), cur)
+			}
+			i++
+		}
+	}
+	if i == len(prev) {
+		if strings.HasPrefix(cur, "-") {
+			return flagCandidates(gfs, "", cur)
+		}
+		for _, c := range commands {
+			cands = append(cands, candidate{c.name, c.summary})
+		}
+		return filterCandidates(cands, cur), false
+	}
+
+	cmd, ok := lookupCommand(prev[i])
+	if !ok {
+		return nil, false
+	}
+	// Only the flags are built; the command itself doesn't run.
+	sub, flags, rest := cmd.sub(prev[i+1:])
+	fs, _ := flags()
+	if fs == nil {
+		return nil, false
+	}
+	key := strings.TrimSpace(cmd.name + " " + sub)
+
+	positional, pending, dashDash := scanArgs(fs, rest)
+	switch {
+	case pending != nil:
+		return completeValues(key, flagKind(key, pending.Name), cur)
+	case strings.HasPrefix(cur, "-") && !dashDash:
+		return flagCandidates(fs, key, cur)
+	case sub == "" && len(positional) == 0 && cmd.subs != nil:
+		for _, s := range cmd.subs {
+			cands = append(cands, candidate{value: s.name})
+		}
+		return filterCandidates(cands, cur), false
+	}
+
+	kinds := argKinds[key]
+	n := len(positional)
+	switch {
+	case n < len(kinds):
+		return completeValues(key, kinds[n], cur)
+	case len(kinds) > 0 && strings.HasSuffix(kinds[len(kinds)-1], "..."):
+		return completeValues(key, kinds[len(kinds)-1], cur)
+	}
+	return nil, false
+}
+
+// applyListFlags picks up --list and --data-dir anywhere on the command
+// line, so todos are completed from the list the command will use.
+func applyListFlags(words []string) {
+	// The last word is still being typed.
+	for i, w := range words[:len(words)-1] {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(w, "-"), "=")
+		if !strings.HasPrefix(w, "-") || (name != "list" && name != "data-dir") {
+			continue
+		}
+		if !hasValue {
+			if i+2 >= len(words) {
+				continue
+			}
+			value = words[i+1]
+		}
+		if name == "list" {
+			global.list = value
+		} else {
+			global.config.DataDir = value
+		}
+	}
+}
+
+func flagKind(key, name string) string {
+	if kind, ok := flagKinds[key+" "+name]; ok {
+		return kind
+	}
+	return flagKinds[name]
+}
+
+// flagCandidates completes flag names, or the value of a --flag=value word.
+func flagCandidates(fs *flag.FlagSet, key, cur string) ([]candidate, bool) {
+	if name, value, ok := strings.Cut(strings.TrimLeft(cur, "-"), "="); ok {
+		f := fs.Lookup(name)
+		if f == nil {
+			return nil, false
+		}
+		values, files := completeValues(key, flagKind(key, name), value)
+		if files {
+			return nil, true
+		}
+		prefix := strings.TrimSuffix(cur, value)
+		for i := range values {
+			values[i].value = prefix + values[i].value
+		}
+		return values, false
+	}
+
+	var cands []candidate
+	fs.VisitAll(func(f *flag.Flag) {
+		cands = append(cands, candidate{"--" + f.Name, f.Usage})
+	})
+	return filterCandidates(cands, cur), false
+}
+
+// completeValues completes an argument or flag value of the given kind.
+func completeValues(key, kind, prefix string) ([]candidate, bool) {
+	if kind == "file" {
+		return nil, true
+	}
+	return filterCandidates(valueCandidates(key, kind), prefix), false
+}
+
+// valueCandidates returns the possible values of an argument or flag of the
+// given kind.
+func valueCandidates(key, kind string) []candidate {
+	names := func(values ...string) []candidate {
+		var cands []candidate
+		for _, v := range values {
+			cands = append(cands, candidate{value: v})
+		}
+		return cands
+	}
+
+	switch strings.TrimSuffix(kind, "...") {
+	case "open-id", "id":
+		return todoCandidates(kind == "open-id")
+	case "archived-id":
+		return archivedCandidates()
+	case "list":
+		lists, _ := listNames()
+		return names(lists...)
+	case "tag":
+		return tagCandidates()
+	case "status":
+		var cands []candidate
+		for _, s := range statuses {
+			cands = append(cands, candidate{value: string(s)})
+		}
+		return cands
+	case "color":
+		return names(colorModes...)
+	case "priority":
+		return names("low", "medium", "high", "none")
+	case "sort":
+		return names(sortKeys[1:]...)
+	case "orphans":
+		return names("reparent", "cascade")
+	case "by":
+		return names("item", "tag", "day")
+	case "time-format":
+		return names(slices.Sorted(maps.Keys(namedTimeFormats))...)
+	case "template":
+		return names(formatNames()...)
+	case "exchange":
+		return names(exchangeFormats...)
+	case "list-output":
+		return names(outputFormats...)
+	case "table-output":
+		return names("table", "json", "jsonl")
+	case "text-output":
+		return names("text", "json")
+	case "shell":
+		return names(slices.Sorted(maps.Keys(completionScripts))...)
+	}
+	return nil
+}
+
+// filterCandidates keeps the candidates starting with prefix.
+func filterCandidates(cands []candidate, prefix string) []candidate {
+	return slices.DeleteFunc(cands, func(c candidate) bool { return !strings.HasPrefix(c.value, prefix) })
+}
+
+// completionTodos reads the active list for completion, without changing
+// any files. Errors, such as a list that can't be decrypted, just mean there
+// is nothing to offer.
+func completionTodos() Todos {
+	name, err := activeList()
+	if err != nil {
+		return nil
+	}
+	var todos Todos
+	viewStoreFile(listFile(name), func(t Todos) error {
+		todos = t
+		return nil
+	})
+	return todos
+}
+
+func todoCandidates(open bool) []candidate {
+	var cands []candidate
+	for _, t := range completionTodos() {
+		if !open || !t.isClosed() {
+			cands = append(cands, candidate{t.ID, t.Title})
+		}
+	}
+	return cands
+}
+
+func tagCandidates() []candidate {
+	var cands []candidate
+	for _, t := range completionTodos() {
+		for _, tag := range t.Tags {
+			if !slices.ContainsFunc(cands, func(c candidate) bool { return c.value == tag }) {
+				cands = append(cands, candidate{value: tag})
+			}
+		}
+	}
+	return cands
+}
+
+func archivedCandidates() []candidate {
+	name, err := activeList()
+	if err != nil {
+		return nil
+	}
+	var cands []candidate
+	viewStoreFile(listFile(name), func(Todos) error {
+		archived, err := loadArchive(name)
+		for _, e := range archived {
+			cands = append(cands, candidate{e.ID, e.Title})
+		}
+		return err
+	})
+	return cands
+}
+
+// cmdComplete is called by the completion scripts with the words of the
+// command line up to the cursor. It prints one candidate per line, with its
+// description after a tab, or completeFilesDirective.
+// cmdComplete has no flag set: every word after its name, flags included,
+// belongs to the command line being completed.
+func cmdComplete() (*flag.FlagSet, func(args []string) error) {
+	return nil, complete
+}
+
+func complete(args []string) error {
+	// Completion must never stop to ask for a passphrase.
+	passphrases = NewKeyring(func() ([]byte, error) {
+		if pass, ok := os.LookupEnv(passphraseEnv); ok {
+			return []byte(pass), nil
+		}
+		return nil, ErrNoPassphrase
+	})
+
+	cands, files := completeWords(args)
+	if files {
+		fmt.Println(completeFilesDirective)
+		return nil
+	}
+	for _, c := range cands {
+		if c.desc == "" {
+			fmt.Println(c.value)
+			continue
+		}
+		// Descriptions are kept to one line.
+		fmt.Printf("%s\t%s\n", c.value, strings.Join(strings.Fields(c.desc), " "))
+	}
+	return nil
+}
+
+// completionScripts are the scripts printed by the completion command, by
+// shell. They call "todo __complete" with the words typed so far.
+var completionScripts = map[string]string{
+	"bash": `# bash completion for todo. Load it with:
+#   source <(todo completion bash)
+_todo() {
+    local cur=${COMP_WORDS[COMP_CWORD]} IFS=$'\n' out
+    out=$(todo __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null) || return
+    if [[ $out == :files ]]; then
+        COMPREPLY=($(compgen -f -- "$cur"))
+        return
+    fi
+    COMPREPLY=($(printf '%s\n' "$out" | cut -f1))
+}
+complete -F _todo todo
+`,
+	"zsh": `#compdef todo
+# zsh completion for todo. Load it with:
+#   source <(todo completion zsh)
+# or save it as _todo in a directory on $fpath.
+_todo() {
+    local -a lines candidates
+    local line
+    lines=("${(@f)$(todo __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    if [[ ${lines[1]} == :files ]]; then
+        _files
+        return
+    fi
+    for line in $lines; do
+        [[ -z $line ]] && continue
+        if [[ $line == *$'\t'* ]]; then
+            candidates+=("${${line%%$'\t'*}//:/\\:}:${line#*$'\t'}")
+        else
+            candidates+=("${line//:/\\:}")
+        fi
+    done
+    _describe todo candidates
+}
+if [[ $funcstack[1] == _todo ]]; then
+    _todo "$@"
+else
+    compdef _todo todo
+fi
+`,
+	"fish": `# fish completion for todo. Load it with:
+#   todo completion fish | source
+function __todo_complete
+    set -l args (commandline -opc)[2..-1]
+    set -l cur (commandline -ct)
+    set -l out (todo __complete $args "$cur" 2>/dev/null)
+    if test "$out[1]" = :files
+        __fish_complete_path "$cur"
+        return
+    end
+    printf '%s\n' $out
+end
+complete -c todo -f -a '(__todo_complete)'
+`,
+}
+
+func cmdCompletion() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("completion", "bash|zsh|fish", "Print a shell completion script. It completes commands, flags, list names\n"+
+		"and todo IDs by calling back into todo.")
+	return fs, func(rest []string) error {
+		if len(rest) != 1 {
+			return usagef("expected exactly one shell")
+		}
+		script, ok := completionScripts[rest[0]]
+		if !ok {
+			return usagef("unsupported shell %q (want bash, zsh or fish)", rest[0])
+		}
+		fmt.Print(script)
+		return nil
+	}
+}
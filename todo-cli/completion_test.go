@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func candidateValues(cands []candidate) []string {
+	var values []string
+	for _, c := range cands {
+		values = append(values, c.value)
+	}
+	return values
+}
+
+func TestCompletionLeavesFilesAlone(t *testing.T) {
+	dir := useDataDir(t)
+	// A list in the oldest format, which loading for a command would
+	// upgrade and back up.
+	v0 := `[{"ID":"a2b3","Title":"Buy milk","Completed":false,"CreatedAt":"2024-03-01T09:00:00Z"}]`
+	file := filepath.Join(dir, defaultList+".json")
+	if err := os.WriteFile(file, []byte(v0), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cands, _ := completeWords([]string{"toggle", ""})
+	if got := candidateValues(cands); !slices.Equal(got, []string{"a2b3"}) {
+		t.Errorf("toggle completes %v, want [a2b3]", got)
+	}
+	completeWords([]string{"archive", "restore", ""})
+
+	if data, _ := os.ReadFile(file); string(data) != v0 {
+		t.Errorf("completion rewrote the list:\n%s", data)
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if e.Name() != defaultList+".json" && e.Name() != defaultList+".json.lock" {
+			t.Errorf("completion created %s", e.Name())
+		}
+	}
+}
+
+func TestCommandFlagsHaveNoEffects(t *testing.T) {
+	dir := useDataDir(t)
+	for _, c := range append(commands, hiddenCommands...) {
+		c.flags()
+		for _, s := range c.subs {
+			s.flags()
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+		t.Errorf("building flag sets created %d file(s)", len(entries))
+	}
+
+	cands, _ := completeWords([]string{"lists", "delete", "--f"})
+	if got := candidateValues(cands); !slices.Equal(got, []string{"--force"}) {
+		t.Errorf("lists delete --f completes %v, want [--force]", got)
+	}
+	cands, _ = completeWords([]string{"lists", ""})
+	if got := candidateValues(cands); !slices.Equal(got, []string{"show", "create", "switch", "rename", "delete"}) {
+		t.Errorf("lists completes %v, want its subcommands", got)
+	}
+}
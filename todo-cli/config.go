@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// config holds the settings. They are layered: built-in defaults, then the
+// configuration file, then environment variables and finally command line
+// flags, each overriding the ones before.
+type config struct {
+	// DataDir is the directory holding the todo lists.
+	DataDir string `json:"data_dir,omitempty"`
+	// DefaultList is the list used when none was selected or switched to.
+	DefaultList string `json:"default_list,omitempty"`
+	// TimeFormat is the default for list --time-format.
+	TimeFormat string `json:"time_format,omitempty"`
+	// Color is when to color output: auto (on terminals, unless NO_COLOR
+	// is set), always or never.
+	Color string `json:"color,omitempty"`
+	// Workflow lists, for each status, the statuses it may change to.
+	Workflow workflow `json:"workflow,omitempty"`
+	// Timezone is the IANA name of the zone dates are read and shown in,
+	// such as "Europe/Berlin". It defaults to the system's zone.
+	Timezone string `json:"timezone,omitempty"`
+	// Formats are named templates for list --format.
+	Formats map[string]string `json:"formats,omitempty"`
+	// Archive sets when closed todos are archived without being asked.
+	Archive archivePolicy `json:"archive,omitempty"`
+
+	// sources tells where each setting's value came from, by key.
+	sources map[string]string
+}
+
+// archivePolicy configures automatic archiving.
+type archivePolicy struct {
+	// After is how long todos stay in the list once closed, such as "14d".
+	// Older ones are archived whenever the list changes. Empty disables
+	// automatic archiving.
+	After string `json:"after,omitempty"`
+}
+
+// colorModes are the accepted values of the color setting.
+var colorModes = []string{"auto", "always", "never"}
+
+// configEnv overrides the location of the configuration file.
+const configEnv = "TODO_CONFIG"
+
+// setting is a string setting that can be given in the configuration file
+// and in the environment. Some also have a flag, see addGlobalFlags.
+type setting struct {
+	key   string
+	env   string
+	field func(c *config) *string
+	// validate checks a value; nil accepts anything.
+	validate func(v string) error
+}
+
+var settings = []setting{
+	{"data_dir", "TODO_DATA_DIR", func(c *config) *string { return &c.DataDir }, nil},
+	{"default_list", "TODO_DEFAULT_LIST", func(c *config) *string { return &c.DefaultList }, validateListName},
+	{"time_format", "TODO_TIME_FORMAT", func(c *config) *string { return &c.TimeFormat }, nil},
+	{"color", "TODO_COLOR", func(c *config) *string { return &c.Color }, validateColor},
+	{"timezone", "TODO_TIMEZONE", func(c *config) *string { return &c.Timezone }, func(v string) error {
+		_, err := time.LoadLocation(v)
+		return err
+	}},
+	{"archive.after", "TODO_ARCHIVE_AFTER", func(c *config) *string { return &c.Archive.After }, func(v string) error {
+		if v == "" {
+			return nil
+		}
+		_, err := parseAge(v)
+		return err
+	}},
+}
+
+func lookupSetting(key string) setting {
+	for _, s := range settings {
+		if s.key == key {
+			return s
+		}
+	}
+	panic("unknown setting " + key)
+}
+
+// set changes a setting and records where the new value came from.
+func (c *config) set(key, value, source string) error {
+	s := lookupSetting(key)
+	if s.validate != nil {
+		if err := s.validate(value); err != nil {
+			return err
+		}
+	}
+	*s.field(c) = value
+	c.sources[key] = source
+	return nil
+}
+
+// source returns where the setting key came from.
+func (c config) source(key string) string {
+	if src, ok := c.sources[key]; ok {
+		return src
+	}
+	return "default"
+}
+
+func validateColor(v string) error {
+	if !slices.Contains(colorModes, v) {
+		return fmt.Errorf("invalid color mode %q (want auto, always or never)", v)
+	}
+	return nil
+}
+
+// location returns the configured time zone, or time.Local.
+func (c config) location() (*time.Location, error) {
+	if c.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(c.Timezone)
+}
+
+func defaultConfig() config {
+	return config{
+		DataDir:     defaultDataDir(),
+		DefaultList: defaultList,
+		Color:       "auto",
+		Workflow:    maps.Clone(defaultWorkflow),
+		sources:     map[string]string{},
+	}
+}
+
+// defaultDataDir returns where the lists are kept unless configured
+// otherwise: the todo directory in the XDG data home, or the current
+// directory if there is no home directory.
+func defaultDataDir() string {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "."
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, programName)
+}
+
+// configFile returns the path of the configuration file: the one named by
+// TODO_CONFIG, or else the one given by the XDG base directory
+// specification.
+func configFile() string {
+	if name := os.Getenv(configEnv); name != "" {
+		return name
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, programName, "config.json")
+}
+
+// loadConfig reads the configuration file and the environment on top of
+// the defaults. A missing file is not an error. Flags are applied later,
+// as they are parsed.
+func loadConfig() (config, error) {
+	cfg := defaultConfig()
+	if err := cfg.loadFile(configFile()); err != nil {
+		return cfg, err
+	}
+	for _, s := range settings {
+		if v := os.Getenv(s.env); v != "" {
+			if err := cfg.set(s.key, v, "env "+s.env); err != nil {
+				return cfg, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+func (c *config) loadFile(name string) error {
+	if name == "" {
+		return nil
+	}
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	// Decoding again into an empty config tells which settings the file
+	// sets, even to their default values.
+	given := config{}
+	json.Unmarshal(data, &given)
+	for _, s := range settings {
+		if *s.field(&given) == "" {
+			continue
+		}
+		if err := c.set(s.key, *s.field(c), "config file"); err != nil {
+			return fmt.Errorf("%s: %s: %w", name, s.key, err)
+		}
+	}
+	if given.Workflow != nil {
+		// Decoding into c merged the file's workflow into the default
+		// one; the file replaces it instead.
+		c.Workflow = given.Workflow
+		if err := c.Workflow.validate(); err != nil {
+			return fmt.Errorf("%s: workflow: %w", name, err)
+		}
+		c.sources["workflow"] = "config file"
+	}
+	if given.Formats != nil {
+		c.sources["formats"] = "config file"
+	}
+	return nil
+}
+
+// settingEnvs returns the environment variables read by loadConfig.
+func settingEnvs() []string {
+	envs := []string{configEnv}
+	for _, s := range settings {
+		envs = append(envs, s.env)
+	}
+	return envs
+}
+
+// settingView is one row of "config show".
+type settingView struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// effectiveSettings lists every setting with its value and source,
+// followed by the list commands would currently use.
+func effectiveSettings() []settingView {
+	c := global.config
+	var rows []settingView
+	for _, s := range settings {
+		rows = append(rows, settingView{s.key, *s.field(&c), c.source(s.key)})
+	}
+
+	var transitions int
+	for _, targets := range c.Workflow {
+		transitions += len(targets)
+	}
+	rows = append(rows,
+		settingView{"workflow", plural(transitions, "transition"), c.source("workflow")},
+		settingView{"formats", strings.Join(formatNames(), ", "), c.source("formats")},
+	)
+
+	list := settingView{Key: "list", Value: global.list, Source: "flag --list"}
+	if list.Value == "" {
+		list.Value, list.Source = currentList(), "lists switch"
+		if _, err := os.Stat(filepath.Join(c.DataDir, currentListFile)); err != nil {
+			list.Source = "default_list"
+		}
+	}
+	return append(rows, list)
+}
+
+func cmdConfig() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("config", "[show]", "Show the effective settings and where each comes from: default, the\n"+
+		"configuration file, an environment variable or a flag. Later sources win.\n\n"+
+		"Environment variables: "+strings.Join(settingEnvs(), ", "))
+	output := fs.String("output", "text", "output format: text or json")
+	return fs, func(rest []string) error {
+		if len(rest) > 0 {
+			return usagef("unknown subcommand %q", rest[0])
+		}
+		if !slices.Contains([]string{"text", "json"}, *output) {
+			return usagef("invalid output format %q (want text or json)", *output)
+		}
+
+		file := configFile()
+		rows := effectiveSettings()
+		if *output == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "    ")
+			return enc.Encode(struct {
+				File     string        `json:"file"`
+				Settings []settingView `json:"settings"`
+			}{file, rows})
+		}
+
+		note := ""
+		if _, err := os.Stat(file); err != nil {
+			note = " (not found)"
+		}
+		fmt.Printf("Config file: %s%s\n\n", file, note)
+		for _, r := range rows {
+			value := r.Value
+			if value == "" {
+				value = "-"
+			}
+			fmt.Printf("%-14s %-24s %s\n", r.Key, value, r.Source)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestConfigWorkflowReplacesDefault(t *testing.T) {
+	original := maps.Clone(defaultWorkflow)
+	for status, targets := range defaultWorkflow {
+		original[status] = slices.Clone(targets)
+	}
+
+	file := filepath.Join(t.TempDir(), "config.json")
+	data := `{"workflow": {"todo": ["done"], "done": ["todo"]}}`
+	if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := defaultConfig()
+	if err := c.loadFile(file); err != nil {
+		t.Fatal(err)
+	}
+
+	want := workflow{StatusTodo: {StatusDone}, StatusDone: {StatusTodo}}
+	if !maps.EqualFunc(c.Workflow, want, slices.Equal) {
+		t.Errorf("workflow = %v, want %v", c.Workflow, want)
+	}
+	if c.source("workflow") != "config file" {
+		t.Errorf("workflow source = %q, want config file", c.source("workflow"))
+	}
+	if !maps.EqualFunc(defaultWorkflow, original, slices.Equal) {
+		t.Errorf("loading a config changed defaultWorkflow to %v", defaultWorkflow)
+	}
+	if fresh := defaultConfig(); !maps.EqualFunc(fresh.Workflow, original, slices.Equal) {
+		t.Errorf("defaultConfig().Workflow = %v after loading a config", fresh.Workflow)
+	}
+}
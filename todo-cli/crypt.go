@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/term"
+)
+
+// encryptionScheme names the only supported way of encrypting stored data:
+// an Argon2id key derived from the passphrase, used with AES-256-GCM.
+const encryptionScheme = "argon2id-aes256gcm"
+
+// Argon2id parameters for newly sealed data, as recommended by RFC 9106 for
+// memory constrained environments. Sealed data records the parameters it
+// was sealed with, so they can change without breaking old files.
+const (
+	argonTime    = 3
+	argonMemory  = 64 * 1024 // KiB
+	argonThreads = 4
+	saltLength   = 16
+	keyLength    = 32
+)
+
+// kdfParams are the Argon2id parameters a key was derived with.
+type kdfParams struct {
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+	Salt    []byte `json:"salt"`
+}
+
+// sealed is the stored form of encrypted data. The header fields identify
+// the scheme and are authenticated along with the ciphertext.
+type sealed struct {
+	Scheme string    `json:"scheme"`
+	KDF    kdfParams `json:"kdf"`
+	Nonce  []byte    `json:"nonce"`
+	Data   []byte    `json:"data"`
+}
+
+// sealedFile wraps sealed data so it can't be mistaken for a plain payload
+// or schema envelope.
+type sealedFile struct {
+	Encrypted *sealed `json:"encrypted"`
+}
+
+// isSealed reports whether fileData holds encrypted data.
+func isSealed(fileData []byte) bool {
+	trimmed := bytes.TrimSpace(fileData)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return false
+	}
+	var f sealedFile
+	return json.Unmarshal(trimmed, &f) == nil && f.Encrypted != nil
+}
+
+// isSealedFile reports whether the file fileName holds encrypted data.
+func isSealedFile(fileName string) bool {
+	data, err := os.ReadFile(fileName)
+	return err == nil && isSealed(data)
+}
+
+// additionalData is the header authenticated with the ciphertext.
+func (s sealed) additionalData() []byte {
+	header := s
+	header.Data = nil
+	data, err := json.Marshal(header)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// Keyring derives encryption keys from a passphrase, asking for the
+// passphrase only once and only when it is needed.
+type Keyring struct {
+	passphrase func() ([]byte, error)
+	pass       []byte
+	// params are used to seal new data; they reuse the salt of the first
+	// data opened, so a load and save need one key derivation, not two.
+	params *kdfParams
+	keys   map[string][]byte
+}
+
+// NewKeyring returns a Keyring that calls passphrase the first time a key
+// is needed.
+func NewKeyring(passphrase func() ([]byte, error)) *Keyring {
+	return &Keyring{passphrase: passphrase, keys: map[string][]byte{}}
+}
+
+func (k *Keyring) key(p kdfParams) ([]byte, error) {
+	id := fmt.Sprintf("%d/%d/%d/%x", p.Time, p.Memory, p.Threads, p.Salt)
+	if key, ok := k.keys[id]; ok {
+		return key, nil
+	}
+	if k.pass == nil {
+		pass, err := k.passphrase()
+		if err != nil {
+			return nil, err
+		}
+		if len(pass) == 0 {
+			return nil, ErrNoPassphrase
+		}
+		k.pass = pass
+	}
+	key := argon2.IDKey(k.pass, p.Salt, p.Time, p.Memory, p.Threads, keyLength)
+	k.keys[id] = key
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plain and returns it in the stored form.
+func (k *Keyring) seal(plain []byte) ([]byte, error) {
+	if k.params == nil {
+		salt := make([]byte, saltLength)
+		rand.Read(salt)
+		k.params = &kdfParams{Time: argonTime, Memory: argonMemory, Threads: argonThreads, Salt: salt}
+	}
+	key, err := k.key(*k.params)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	s := sealed{Scheme: encryptionScheme, KDF: *k.params, Nonce: make([]byte, gcm.NonceSize())}
+	rand.Read(s.Nonce)
+	s.Data = gcm.Seal(nil, s.Nonce, plain, s.additionalData())
+	return json.MarshalIndent(sealedFile{Encrypted: &s}, "", "    ")
+}
+
+// open decrypts data in the stored form.
+func (k *Keyring) open(fileData []byte) ([]byte, error) {
+	var f sealedFile
+	if err := json.Unmarshal(fileData, &f); err != nil || f.Encrypted == nil {
+		return nil, fmt.Errorf("%w: malformed encrypted data", ErrCorrupt)
+	}
+	s := *f.Encrypted
+	if s.Scheme != encryptionScheme {
+		return nil, fmt.Errorf("%w: unknown encryption scheme %q", ErrUnsupportedVersion, s.Scheme)
+	}
+
+	key, err := k.key(s.KDF)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("%w: bad nonce", ErrCorrupt)
+	}
+	plain, err := gcm.Open(nil, s.Nonce, s.Data, s.additionalData())
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	if k.params == nil {
+		params := s.KDF
+		k.params = &params
+	}
+	return plain, nil
+}
+
+// passphraseEnv and newPassphraseEnv let scripts supply passphrases
+// without a terminal.
+const (
+	passphraseEnv    = "TODO_PASSPHRASE"
+	newPassphraseEnv = "TODO_NEW_PASSPHRASE"
+)
+
+// passphrases unlocks the encrypted lists of this process.
+var passphrases = NewKeyring(func() ([]byte, error) {
+	return readPassphrase(passphraseEnv, "Passphrase: ", false)
+})
+
+// readPassphrase takes the passphrase from the environment variable env or
+// else asks for it on the terminal, twice when confirm is set.
+func readPassphrase(env, prompt string, confirm bool) ([]byte, error) {
+	if pass, ok := os.LookupEnv(env); ok {
+		return []byte(pass), nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("%w: set %s", ErrNoPassphrase, env)
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	pass, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil || !confirm {
+		return pass, err
+	}
+	fmt.Fprint(os.Stderr, "Repeat: ")
+	again, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(pass, again) {
+		return nil, fmt.Errorf("passphrases don't match")
+	}
+	return pass, nil
+}
+
+func cmdRekey() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("rekey", "", "Encrypt the list with a new passphrase, taken from "+newPassphraseEnv+" or asked for.\n"+
+		"Use it to encrypt a plain list or to change the passphrase of an encrypted one.\n"+
+		"Backups written by format upgrades are left as they are.")
+	remove := fs.Bool("remove", false, "decrypt the list and store it as plain JSON")
+	return fs, func(rest []string) error {
+		if len(rest) > 0 {
+			return usagef("unexpected arguments: %v", rest)
+		}
+
+		name, err := activeList()
+		if err != nil {
+			return err
+		}
+		todoFile := listFile(name)
+
+		storage := newTodoStorage(todoFile)
+		unlock, err := storage.Lock()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		todos := Todos{}
+		history := History{}
+		if err := storage.Load(&todos); err != nil {
+			return err
+		}
+		if err := newHistoryStorage(historyFile(todoFile)).Load(&history); err != nil {
+			return err
+		}
+		archives, err := archiveFiles(name)
+		if err != nil {
+			return err
+		}
+		archived := make([][]archivedTodo, len(archives))
+		for i, f := range archives {
+			if err := newArchiveStorage(f).Load(&archived[i]); err != nil {
+				return err
+			}
+		}
+
+		var opts []StorageOption
+		if !*remove {
+			pass, err := readPassphrase(newPassphraseEnv, "New passphrase: ", true)
+			if err != nil {
+				return err
+			}
+			if len(pass) == 0 {
+				return ErrNoPassphrase
+			}
+			opts = append(opts, WithEncryption(NewKeyring(func() ([]byte, error) { return pass, nil })))
+		}
+		if err := newTodoStorage(todoFile, opts...).Save(todos); err != nil {
+			return err
+		}
+		if err := newHistoryStorage(historyFile(todoFile), opts...).Save(history); err != nil {
+			return err
+		}
+		for i, f := range archives {
+			if err := newArchiveStorage(f, opts...).Save(archived[i]); err != nil {
+				return err
+			}
+		}
+
+		if *remove {
+			fmt.Printf("Decrypted list %q\n", name)
+		} else {
+			fmt.Printf("Encrypted list %q with the new passphrase\n", name)
+		}
+		return nil
+	}
+}
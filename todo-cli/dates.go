@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clock returns the current time. Everything that depends on "now" asks
+// clock, so it can be pinned to a fixed time.
+var clock = time.Now
+
+// zone returns the configured time zone, or time.Local before run has
+// loaded the configuration.
+func zone() *time.Location {
+	if global.location == nil {
+		return time.Local
+	}
+	return global.location
+}
+
+// local returns t in the configured zone. Stored times keep the offset they
+// were recorded with, so they are converted when shown.
+func local(t time.Time) time.Time {
+	return t.In(zone())
+}
+
+// dateFormats are the absolute formats accepted by parseWhen. The bool
+// tells whether the format includes a time of day.
+var dateFormats = []struct {
+	layout  string
+	hasTime bool
+}{
+	{time.RFC3339, true},
+	{"2006-01-02T15:04", true},
+	{"2006-01-02 15:04", true},
+	{dayFormat, false},
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tues": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// clockTime matches a time of day such as "5pm", "5:30pm" or "17:00".
+var clockTime = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)?$`)
+
+// amount matches a count with an optional unit attached, as in "3" or "3d".
+var amount = regexp.MustCompile(`^(\d+)([a-z]*)$`)
+
+// dateHelp describes the accepted date expressions in flag usages.
+const dateHelp = "e.g. 2024-05-01, \"tomorrow 5pm\", \"next fri\", \"in 3 days\" or eom"
+
+// parseWhen resolves a date expression against now, in now's location. It
+// accepts absolute dates ("2024-05-01", "2024-05-01 17:00", RFC3339) and
+// phrases such as "today", "tomorrow 5pm", "fri", "next fri", "next week",
+// "in 3 days", "2 hours", "eod", "eow", "eom" and "eoy". hasTime reports
+// whether the expression fixed a time of day; if not, the result is at
+// midnight.
+func parseWhen(s string, now time.Time) (t time.Time, hasTime bool, err error) {
+	s = strings.Join(strings.Fields(s), " ")
+	if s == "" {
+		return time.Time{}, false, fmt.Errorf("empty date")
+	}
+	// The absolute formats are case sensitive ("T", "Z").
+	for _, f := range dateFormats {
+		if t, err := time.ParseInLocation(f.layout, s, now.Location()); err == nil {
+			return t, f.hasTime, nil
+		}
+	}
+	s = strings.ToLower(s)
+
+	invalid := fmt.Errorf("invalid date %q (%s)", s, dateHelp)
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	day, hasDay := today, false
+	var exact *time.Time
+	hour, minute := 0, 0
+
+	setDay := func(t time.Time) error {
+		if hasDay || exact != nil {
+			return invalid
+		}
+		day, hasDay = t, true
+		return nil
+	}
+
+	words := strings.Fields(s)
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		var err error
+		switch w {
+		case "at", "on", "by":
+			continue
+		case "now":
+			if hasDay || hasTime {
+				return time.Time{}, false, invalid
+			}
+			exact = &now
+		case "today", "eod":
+			err = setDay(today)
+		case "tomorrow", "tmr", "tmrw":
+			err = setDay(today.AddDate(0, 0, 1))
+		case "yesterday":
+			err = setDay(today.AddDate(0, 0, -1))
+		case "eow":
+			err = setDay(today.AddDate(0, 0, (7-int(today.Weekday()))%7))
+		case "eom":
+			err = setDay(time.Date(y, m+1, 0, 0, 0, 0, 0, now.Location()))
+		case "eoy":
+			err = setDay(time.Date(y, time.December, 31, 0, 0, 0, 0, now.Location()))
+		case "noon", "midday":
+			hour, minute, hasTime = 12, 0, true
+		case "midnight":
+			hour, minute, hasTime = 0, 0, true
+		case "next":
+			if i+1 == len(words) {
+				return time.Time{}, false, invalid
+			}
+			i++
+			switch next := words[i]; next {
+			case "week":
+				err = setDay(today.AddDate(0, 0, 7-(int(today.Weekday())+6)%7))
+			case "month":
+				err = setDay(time.Date(y, m+1, 1, 0, 0, 0, 0, now.Location()))
+			case "year":
+				err = setDay(time.Date(y+1, time.January, 1, 0, 0, 0, 0, now.Location()))
+			default:
+				wd, ok := weekdays[next]
+				if !ok {
+					return time.Time{}, false, invalid
+				}
+				ahead := (int(wd) - int(today.Weekday()) + 7) % 7
+				if ahead == 0 {
+					ahead = 7
+				}
+				err = setDay(today.AddDate(0, 0, ahead))
+			}
+		case "in":
+			// "in" only introduces an amount; the amount itself is
+			// handled below.
+			if i+1 == len(words) {
+				return time.Time{}, false, invalid
+			}
+			continue
+		case "from", "later", "ago":
+			// "3 days from now" and "2 days later" read like "in".
+			if w == "from" && i+1 < len(words) && words[i+1] == "now" {
+				i++
+			}
+			continue
+		default:
+			if wd, ok := weekdays[w]; ok {
+				err = setDay(today.AddDate(0, 0, (int(wd)-int(today.Weekday())+7)%7))
+				break
+			}
+			if t, err := time.ParseInLocation(dayFormat, w, now.Location()); err == nil {
+				if err := setDay(t); err != nil {
+					return time.Time{}, false, err
+				}
+				break
+			}
+			if c := clockTime.FindStringSubmatch(w); c != nil && (c[2] != "" || c[3] != "" || isMeridiem(words, i+1)) {
+				ampm := c[3]
+				if ampm == "" && isMeridiem(words, i+1) {
+					ampm = words[i+1]
+					i++
+				}
+				if hour, minute, err = timeOfDay(c[1], c[2], ampm); err != nil {
+					return time.Time{}, false, err
+				}
+				hasTime = true
+				break
+			}
+			a := amount.FindStringSubmatch(w)
+			if a == nil {
+				return time.Time{}, false, invalid
+			}
+			n, _ := strconv.Atoi(a[1])
+			unit := a[2]
+			if unit == "" {
+				if i+1 == len(words) {
+					return time.Time{}, false, invalid
+				}
+				i++
+				unit = words[i]
+			}
+			if i+1 < len(words) && words[i+1] == "ago" {
+				n = -n
+				i++
+			}
+			var t time.Time
+			var exactUnit bool
+			if t, exactUnit, err = addAmount(now, today, n, unit); err != nil {
+				return time.Time{}, false, invalid
+			}
+			if exactUnit {
+				if hasDay || hasTime || exact != nil {
+					return time.Time{}, false, invalid
+				}
+				exact = &t
+			} else {
+				err = setDay(t)
+			}
+		}
+		if err != nil {
+			return time.Time{}, false, err
+		}
+	}
+
+	if exact != nil {
+		if hasTime {
+			return time.Time{}, false, invalid
+		}
+		return *exact, true, nil
+	}
+	if !hasDay && !hasTime {
+		return time.Time{}, false, invalid
+	}
+	t = time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, now.Location())
+	// A bare time of day that has passed already means tomorrow.
+	if !hasDay && t.Before(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, hasTime, nil
+}
+
+func isMeridiem(words []string, i int) bool {
+	return i < len(words) && (words[i] == "am" || words[i] == "pm")
+}
+
+// timeOfDay converts the parts of a clock time to a 24 hour time.
+func timeOfDay(h, m, ampm string) (hour, minute int, err error) {
+	hour, _ = strconv.Atoi(h)
+	if m != "" {
+		minute, _ = strconv.Atoi(m)
+	}
+	switch ampm {
+	case "am", "pm":
+		if hour < 1 || hour > 12 {
+			return 0, 0, fmt.Errorf("invalid time %s:%02d%s", h, minute, ampm)
+		}
+		hour %= 12
+		if ampm == "pm" {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return 0, 0, fmt.Errorf("invalid time %s:%s", h, m)
+	}
+	return hour, minute, nil
+}
+
+// addAmount adds n units to now or today. exact is true for units smaller
+// than a day, which give a point in time rather than a date.
+func addAmount(now, today time.Time, n int, unit string) (t time.Time, exact bool, err error) {
+	switch strings.TrimSuffix(unit, "s") {
+	case "m", "min", "minute":
+		return now.Add(time.Duration(n) * time.Minute), true, nil
+	case "h", "hr", "hour":
+		return now.Add(time.Duration(n) * time.Hour), true, nil
+	case "d", "day":
+		return today.AddDate(0, 0, n), false, nil
+	case "w", "wk", "week":
+		return today.AddDate(0, 0, 7*n), false, nil
+	case "mo", "month":
+		return today.AddDate(0, n, 0), false, nil
+	case "y", "yr", "year":
+		return today.AddDate(n, 0, 0), false, nil
+	}
+	return time.Time{}, false, fmt.Errorf("unknown unit %q", unit)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newYork is used by the date tests for its DST changes: clocks went
+// forward on 10 March 2024 and back on 3 November 2024.
+func newYork(t *testing.T) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone database not available: %v", err)
+	}
+	return loc
+}
+
+// pinClock fixes clock, and the configured zone to now's, for the rest of
+// the test.
+func pinClock(t *testing.T, now time.Time) {
+	t.Helper()
+	oldClock, oldLocation := clock, global.location
+	clock = func() time.Time { return now }
+	global.location = now.Location()
+	t.Cleanup(func() { clock, global.location = oldClock, oldLocation })
+}
+
+func TestParseWhen(t *testing.T) {
+	loc := newYork(t)
+	at := func(y int, m time.Month, d, h, min int) time.Time {
+		return time.Date(y, m, d, h, min, 0, 0, loc)
+	}
+	// Wednesday, four days before DST starts.
+	now := at(2024, time.March, 6, 10, 0)
+
+	tests := []struct {
+		in      string
+		now     time.Time
+		want    time.Time
+		hasTime bool
+	}{
+		{"today", now, at(2024, 3, 6, 0, 0), false},
+		{"tomorrow", now, at(2024, 3, 7, 0, 0), false},
+		{"tomorrow 5pm", now, at(2024, 3, 7, 17, 0), true},
+		{"Tomorrow at 5:30 PM", now, at(2024, 3, 7, 17, 30), true},
+		{"yesterday", now, at(2024, 3, 5, 0, 0), false},
+		{"fri", now, at(2024, 3, 8, 0, 0), false},
+		{"next fri", now, at(2024, 3, 8, 0, 0), false},
+		{"wed", now, at(2024, 3, 6, 0, 0), false},
+		{"next wed", now, at(2024, 3, 13, 0, 0), false},
+		{"next week", now, at(2024, 3, 11, 0, 0), false},
+		{"next month", now, at(2024, 4, 1, 0, 0), false},
+		{"next year", now, at(2025, 1, 1, 0, 0), false},
+		{"in 3 days", now, at(2024, 3, 9, 0, 0), false},
+		{"3d", now, at(2024, 3, 9, 0, 0), false},
+		{"in 2 weeks", now, at(2024, 3, 20, 0, 0), false},
+		{"3 days ago", now, at(2024, 3, 3, 0, 0), false},
+		{"in 2 hours", now, at(2024, 3, 6, 12, 0), true},
+		{"eod", now, at(2024, 3, 6, 0, 0), false},
+		{"eow", now, at(2024, 3, 10, 0, 0), false},
+		{"eom", now, at(2024, 3, 31, 0, 0), false},
+		{"eom", at(2024, 2, 10, 9, 0), at(2024, 2, 29, 0, 0), false},
+		{"eoy", now, at(2024, 12, 31, 0, 0), false},
+		{"noon", now, at(2024, 3, 6, 12, 0), true},
+		{"5pm", now, at(2024, 3, 6, 17, 0), true},
+		// A time of day that has passed means tomorrow.
+		{"9am", now, at(2024, 3, 7, 9, 0), true},
+		{"17:00", now, at(2024, 3, 6, 17, 0), true},
+		{"now", now, now, true},
+		{"2024-05-01", now, at(2024, 5, 1, 0, 0), false},
+		{"2024-05-01 17:00", now, at(2024, 5, 1, 17, 0), true},
+		{"2024-05-01T17:00", now, at(2024, 5, 1, 17, 0), true},
+		{"2024-05-01T17:00:00Z", now, time.Date(2024, 5, 1, 17, 0, 0, 0, time.UTC), true},
+		{"2024-05-01 5pm", now, at(2024, 5, 1, 17, 0), true},
+
+		// DST: days keep their wall clock times across the change,
+		// hours don't.
+		{"sun 9am", now, at(2024, 3, 10, 9, 0), true},
+		{"in 5 days", now, at(2024, 3, 11, 0, 0), false},
+		{"in 2 hours", at(2024, 3, 10, 1, 30), at(2024, 3, 10, 4, 30), true},
+		{"tomorrow", at(2024, 11, 2, 12, 0), at(2024, 11, 3, 0, 0), false},
+		{"in 1 day", at(2024, 11, 3, 0, 30), at(2024, 11, 4, 0, 0), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, hasTime, err := parseWhen(tt.in, tt.now)
+			if err != nil {
+				t.Fatalf("parseWhen(%q): %v", tt.in, err)
+			}
+			if !got.Equal(tt.want) || hasTime != tt.hasTime {
+				t.Errorf("parseWhen(%q) = %v, %v; want %v, %v", tt.in, got, hasTime, tt.want, tt.hasTime)
+			}
+		})
+	}
+}
+
+func TestParseWhenInvalid(t *testing.T) {
+	now := time.Date(2024, time.March, 6, 10, 0, 0, 0, time.UTC)
+	for _, in := range []string{
+		"",
+		"   ",
+		"someday",
+		"next",
+		"next blursday",
+		"in",
+		"in 3",
+		"in 3 fortnights",
+		"tomorrow yesterday",
+		"fri 2024-05-01",
+		"13pm",
+		"0am",
+		"25:00",
+		"17:75",
+		"in 2 hours 5pm",
+		"now 5pm",
+		"2024-13-01",
+	} {
+		if got, _, err := parseWhen(in, now); err == nil {
+			t.Errorf("parseWhen(%q) = %v, want an error", in, got)
+		}
+	}
+}
+
+func TestParseDue(t *testing.T) {
+	loc := newYork(t)
+	pinClock(t, time.Date(2024, time.March, 6, 10, 0, 0, 0, loc))
+
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		// A day without a time means its last second, also on the days
+		// that are 23 and 25 hours long.
+		{"2024-03-06", time.Date(2024, 3, 6, 23, 59, 59, 0, loc)},
+		{"2024-03-10", time.Date(2024, 3, 10, 23, 59, 59, 0, loc)},
+		{"2024-11-03", time.Date(2024, 11, 3, 23, 59, 59, 0, loc)},
+		{"tomorrow 5pm", time.Date(2024, 3, 7, 17, 0, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		got, err := parseDue(tt.in)
+		if err != nil {
+			t.Fatalf("parseDue(%q): %v", tt.in, err)
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseDue(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	if due, err := parseDue(""); due != nil || err != nil {
+		t.Errorf("parseDue(\"\") = %v, %v; want no due date", due, err)
+	}
+}
+
+func TestTimezoneSetting(t *testing.T) {
+	newYork(t)
+	useDefaultConfig(t)
+	oldLocation, oldLocal := global.location, time.Local
+	t.Cleanup(func() { global.location = oldLocation })
+	t.Setenv(configEnv, filepath.Join(t.TempDir(), "config.json"))
+	t.Setenv("TODO_DATA_DIR", t.TempDir())
+	t.Setenv("TODO_TIMEZONE", "America/New_York")
+
+	if code := run([]string{"config"}); code != exitOK {
+		t.Fatalf("run = %d, want %d", code, exitOK)
+	}
+	if zone().String() != "America/New_York" {
+		t.Errorf("zone() = %v, want America/New_York", zone())
+	}
+	if time.Local != oldLocal {
+		t.Errorf("time.Local changed to %v", time.Local)
+	}
+}
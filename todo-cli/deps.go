@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aquasecurity/table"
+)
+
+var (
+	// ErrDependencyCycle is returned when a todo would end up blocking
+	// itself, directly or through other todos.
+	ErrDependencyCycle = errors.New("dependency cycle")
+	// ErrBlocked is returned when completing a todo whose blockers are
+	// still open.
+	ErrBlocked = errors.New("todo is blocked")
+)
+
+// openBlockers returns the IDs of the todos blocking t that are still open.
+// Blockers that no longer exist don't count.
+func (todos Todos) openBlockers(t Todo) []string {
+	var open []string
+	for _, id := range t.BlockedBy {
+		if i, err := todos.indexOf(id); err == nil && !todos[i].isClosed() {
+			open = append(open, id)
+		}
+	}
+	return open
+}
+
+func (todos Todos) isBlocked(t Todo) bool {
+	return len(todos.openBlockers(t)) > 0
+}
+
+// blocks reports whether from blocks to, directly or through other todos.
+func (todos Todos) blocks(from, to string) bool {
+	seen := map[string]bool{}
+	queue := []string{to}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		i, err := todos.indexOf(id)
+		if err != nil || seen[id] {
+			continue
+		}
+		seen[id] = true
+		for _, b := range todos[i].BlockedBy {
+			if b == from {
+				return true
+			}
+			queue = append(queue, b)
+		}
+	}
+	return false
+}
+
+// addBlocker records that blocker must be done before id.
+func (todos *Todos) addBlocker(id, blocker string) error {
+	bi, err := todos.indexOf(blocker)
+	if err != nil {
+		return err
+	}
+	blocker = (*todos)[bi].ID
+	return todos.update(id, func(t *Todo) error {
+		if blocker == t.ID || todos.blocks(t.ID, blocker) {
+			return fmt.Errorf("%w: %s already depends on %s", ErrDependencyCycle, blocker, t.ID)
+		}
+		if !slices.Contains(t.BlockedBy, blocker) {
+			t.BlockedBy = append(t.BlockedBy, blocker)
+		}
+		return nil
+	})
+}
+
+// removeBlocker drops blocker from the blockers of id.
+func (todos *Todos) removeBlocker(id, blocker string) error {
+	blocker = normalizeID(blocker)
+	return todos.update(id, func(t *Todo) error {
+		t.BlockedBy = slices.DeleteFunc(t.BlockedBy, func(b string) bool { return b == blocker })
+		return nil
+	})
+}
+
+// dropBlockers removes references to todos that are no longer in the list.
+func (todos Todos) dropBlockers() {
+	for i := range todos {
+		if len(todos[i].BlockedBy) == 0 {
+			continue
+		}
+		todos[i].BlockedBy = slices.DeleteFunc(todos[i].BlockedBy, func(b string) bool {
+			_, err := todos.indexOf(b)
+			return err != nil
+		})
+		if len(todos[i].BlockedBy) == 0 {
+			todos[i].BlockedBy = nil
+		}
+	}
+}
+
+// checkBlockers returns ErrBlocked if the todo at index still has open
+// blockers.
+func (todos Todos) checkBlockers(index int) error {
+	t := todos[index]
+	if open := todos.openBlockers(t); len(open) > 0 {
+		return fmt.Errorf("%w by %s (use --force to complete it anyway)", ErrBlocked, strings.Join(open, ", "))
+	}
+	return nil
+}
+
+// actionable returns the open todos that can be worked on now: not blocked
+// by other todos or set to the blocked status. They are ordered by
+// priority, then by due date.
+func (todos Todos) actionable() Todos {
+	var result Todos
+	for _, t := range todos {
+		if t.isClosed() || t.status() == StatusBlocked || todos.isBlocked(t) {
+			continue
+		}
+		result = append(result, t)
+	}
+	byDue := sortLess("due")
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Priority.rank() != b.Priority.rank() {
+			return a.Priority.rank() > b.Priority.rank()
+		}
+		return byDue(a, b)
+	})
+	return result
+}
+
+func cmdNext() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("next", "", "List the todos that can be worked on now, most important first.")
+	limit := fs.Int("n", 0, "show at most this many todos")
+	tag := fs.String("tag", "", "only show todos with this tag")
+	ascii := fs.Bool("ascii", false, "use plain ASCII box drawing characters")
+	return fs, func(rest []string) error {
+		if len(rest) > 0 {
+			return usagef("unexpected arguments: %v", rest)
+		}
+		if *limit < 0 {
+			return usagef("-n must not be negative")
+		}
+
+		return withTodos("", func(todos *Todos) error {
+			var rows Todos
+			for _, t := range todos.actionable() {
+				if *tag == "" || t.hasTag(*tag) {
+					rows = append(rows, t)
+				}
+			}
+			if *limit > 0 && len(rows) > *limit {
+				rows = rows[:*limit]
+			}
+			if len(rows) == 0 {
+				fmt.Println("Nothing to do")
+				return nil
+			}
+
+			tbl := table.New(os.Stdout)
+			if *ascii {
+				tbl.SetDividers(table.ASCIIDividers)
+			}
+			tbl.SetRowLines(false)
+			tbl.SetHeaders("ID", "Title", "Priority", "Due", "Tags")
+			now := clock()
+			for _, t := range rows {
+				due := ""
+				if t.Due != nil {
+					due = local(*t.Due).Format(dueFormat)
+					if t.isOverdue(now) {
+						due += " (overdue)"
+					}
+				}
+				tbl.AddRow(t.ID, t.Title, string(t.Priority), due, strings.Join(t.Tags, ", "))
+			}
+			tbl.Render()
+			return nil
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import "errors"
+
+// Sentinel errors returned by Todos operations and Storage. Match them with
+// errors.Is; the returned errors wrap them with details.
+var (
+	// ErrNotFound means no todo has the requested ID.
+	ErrNotFound = errors.New("todo not found")
+	// ErrInvalidIndex means a position is outside the list.
+	ErrInvalidIndex = errors.New("invalid index")
+	// ErrCorrupt means the stored data could not be decoded.
+	ErrCorrupt = errors.New("corrupt data file")
+	// ErrUnsupportedVersion means the stored data was written by a newer
+	// version of the program.
+	ErrUnsupportedVersion = errors.New("unsupported schema version")
+	// ErrNoPassphrase means stored data is encrypted and no passphrase
+	// was given.
+	ErrNoPassphrase = errors.New("data is encrypted and no passphrase was given")
+	// ErrDecrypt means encrypted data could not be decrypted, because the
+	// passphrase is wrong or the data was altered.
+	ErrDecrypt = errors.New("wrong passphrase or tampered data")
+)
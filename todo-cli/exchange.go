@@ -0,0 +1,457 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exchangeFormats lists the formats supported by import and export.
+var exchangeFormats = []string{"csv", "markdown", "todotxt"}
+
+// detectFormat picks an exchange format from a file name extension.
+func detectFormat(fileName string) (string, bool) {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv":
+		return "csv", true
+	case ".md", ".markdown":
+		return "markdown", true
+	case ".txt":
+		return "todotxt", true
+	}
+	return "", false
+}
+
+func exportTodos(w io.Writer, format string, todos Todos) error {
+	switch format {
+	case "csv":
+		return writeCSV(w, todos)
+	case "markdown":
+		return writeMarkdown(w, todos)
+	case "todotxt":
+		return writeTodoTxt(w, todos)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+func importTodos(r io.Reader, format string) (Todos, error) {
+	switch format {
+	case "csv":
+		return readCSV(r)
+	case "markdown":
+		return readMarkdown(r)
+	case "todotxt":
+		return readTodoTxt(r)
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// merge appends imported todos to the list. Imported IDs are kept unless
+// they are missing or already taken; parent and blocker links between
+// imported todos follow any renamed IDs. It returns the number of todos
+// added.
+func (todos *Todos) merge(imported Todos) int {
+	renamed := map[string]string{}
+	for i := range imported {
+		t := &imported[i]
+		old := t.ID
+		if _, err := todos.indexOf(t.ID); t.ID == "" || err == nil {
+			t.ID = todos.newID()
+		}
+		if old != "" {
+			renamed[old] = t.ID
+		}
+		now := clock()
+		if t.CreatedAt.IsZero() {
+			t.CreatedAt = now
+		}
+		if t.Status == "" {
+			t.Status = StatusTodo
+		}
+		if len(t.Transitions) == 0 || t.Transitions[0].Status != StatusTodo {
+			t.Transitions = append([]Transition{{Status: StatusTodo, At: t.CreatedAt}}, t.Transitions...)
+		}
+		if t.enteredAt() == nil {
+			t.Transitions = append(t.Transitions, Transition{Status: t.Status, At: now})
+		}
+		*todos = append(*todos, *t)
+	}
+
+	// Parents and blockers that are neither imported nor already in the
+	// list are dropped.
+	added := (*todos)[len(*todos)-len(imported):]
+	for i := range added {
+		if added[i].ParentID == "" {
+			continue
+		}
+		if id, ok := renamed[added[i].ParentID]; ok {
+			added[i].ParentID = id
+		} else if _, err := todos.indexOf(added[i].ParentID); err != nil {
+			added[i].ParentID = ""
+		}
+	}
+	for i := range added {
+		for j, id := range added[i].BlockedBy {
+			if renamed, ok := renamed[id]; ok {
+				added[i].BlockedBy[j] = renamed
+			}
+		}
+	}
+	todos.dropBlockers()
+	return len(imported)
+}
+
+// CSV: one row per todo with a header naming the columns. Times are RFC3339
+// and tags are separated by spaces. The Completed column is kept for files
+// written before statuses existed; Status wins when both are present.
+
+var csvHeader = []string{"ID", "Title", "Status", "Completed", "CreatedAt", "CompletedAt", "Due", "Priority", "Tags", "Repeat", "Parent", "BlockedBy"}
+
+func recurrenceString(r *Recurrence) string {
+	if r == nil {
+		return ""
+	}
+	return r.String()
+}
+
+func formatTimePtr(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func parseTimePtr(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func writeCSV(w io.Writer, todos Todos) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for _, t := range todos {
+		cw.Write([]string{
+			t.ID,
+			t.Title,
+			string(t.status()),
+			strconv.FormatBool(t.isDone()),
+			t.CreatedAt.Format(time.RFC3339Nano),
+			formatTimePtr(t.completedAt()),
+			formatTimePtr(t.Due),
+			string(t.Priority),
+			strings.Join(t.Tags, " "),
+			recurrenceString(t.Recur),
+			t.ParentID,
+			strings.Join(t.BlockedBy, " "),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func readCSV(r io.Reader) (Todos, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, fmt.Errorf("csv: missing Title column")
+	}
+
+	var todos Todos
+	for n, record := range records[1:] {
+		line := n + 2
+		get := func(name string) string {
+			if i, ok := columns[strings.ToLower(name)]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		t := Todo{ID: normalizeID(get("ID")), Title: get("Title"), Status: StatusTodo}
+		if v := get("Status"); v != "" {
+			if t.Status, err = parseStatus(v); err != nil {
+				return nil, fmt.Errorf("csv line %d: %v", line, err)
+			}
+		} else if v := get("Completed"); v != "" {
+			completed, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("csv line %d: Completed: %v", line, err)
+			}
+			if completed {
+				t.Status = StatusDone
+			}
+		}
+		if v := get("CreatedAt"); v != "" {
+			if t.CreatedAt, err = time.Parse(time.RFC3339Nano, v); err != nil {
+				return nil, fmt.Errorf("csv line %d: CreatedAt: %v", line, err)
+			}
+		}
+		completedAt, err := parseTimePtr(get("CompletedAt"))
+		if err != nil {
+			return nil, fmt.Errorf("csv line %d: CompletedAt: %v", line, err)
+		}
+		if completedAt != nil && t.isDone() {
+			t.Transitions = []Transition{{Status: StatusDone, At: *completedAt}}
+		}
+		if t.Due, err = parseTimePtr(get("Due")); err != nil {
+			return nil, fmt.Errorf("csv line %d: Due: %v", line, err)
+		}
+		if t.Priority, err = parsePriority(get("Priority")); err != nil {
+			return nil, fmt.Errorf("csv line %d: %v", line, err)
+		}
+		t.Tags = normalizeTags(strings.Fields(get("Tags")))
+		if t.Recur, err = parseRecurrence(get("Repeat")); err != nil {
+			return nil, fmt.Errorf("csv line %d: %v", line, err)
+		}
+		t.ParentID = normalizeID(get("Parent"))
+		for _, id := range strings.Fields(get("BlockedBy")) {
+			t.BlockedBy = append(t.BlockedBy, normalizeID(id))
+		}
+		todos = append(todos, t)
+	}
+	return todos, nil
+}
+
+// Markdown: a GitHub style checklist, with subtasks as nested items. Only
+// the title, nesting and whether a todo is done are represented.
+
+var checklistItem = regexp.MustCompile(`^(\s*)[-*+]\s+\[([ xX])\]\s+(.*)$`)
+
+func writeMarkdown(w io.Writer, todos Todos) error {
+	rows, depths := treeOrder(todos)
+	for i, t := range rows {
+		mark := " "
+		if t.isDone() {
+			mark = "x"
+		}
+		indent := strings.Repeat("  ", depths[i])
+		if _, err := fmt.Fprintf(w, "%s- [%s] %s\n", indent, mark, t.Title); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readMarkdown(r io.Reader) (Todos, error) {
+	type level struct {
+		indent int
+		id     string
+	}
+	var todos Todos
+	var stack []level
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		m := checklistItem.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		indent := len(strings.ReplaceAll(m[1], "\t", "    "))
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+
+		// Provisional IDs link subtasks to their parents; merge
+		// replaces them if they clash with existing todos.
+		t := Todo{
+			ID:     todos.newID(),
+			Title:  strings.TrimSpace(m[3]),
+			Status: StatusTodo,
+		}
+		if m[2] != " " {
+			t.Status = StatusDone
+		}
+		if len(stack) > 0 {
+			t.ParentID = stack[len(stack)-1].id
+		}
+		todos = append(todos, t)
+		stack = append(stack, level{indent, t.ID})
+	}
+	return todos, scanner.Err()
+}
+
+// todo.txt: see https://github.com/todotxt/todo.txt. Dates have day
+// precision; tags become +project tags, except tags starting with "@" which
+// are written as contexts. Done todos are marked with "x"; other statuses
+// than todo go in a status: key.
+
+const todoTxtDate = "2006-01-02"
+
+var todoTxtPriorities = map[Priority]string{
+	PriorityHigh:   "A",
+	PriorityMedium: "B",
+	PriorityLow:    "C",
+}
+
+func todoTxtPriority(letter string) Priority {
+	switch letter {
+	case "A":
+		return PriorityHigh
+	case "B":
+		return PriorityMedium
+	default:
+		return PriorityLow
+	}
+}
+
+func writeTodoTxt(w io.Writer, todos Todos) error {
+	for _, t := range todos {
+		var parts []string
+		if t.isDone() {
+			parts = append(parts, "x")
+			if at := t.completedAt(); at != nil {
+				parts = append(parts, local(*at).Format(todoTxtDate))
+			}
+		} else if letter, ok := todoTxtPriorities[t.Priority]; ok {
+			parts = append(parts, "("+letter+")")
+		}
+		parts = append(parts, local(t.CreatedAt).Format(todoTxtDate), t.Title)
+		for _, tag := range t.Tags {
+			if strings.HasPrefix(tag, "@") {
+				parts = append(parts, tag)
+			} else {
+				parts = append(parts, "+"+tag)
+			}
+		}
+		if t.Due != nil {
+			parts = append(parts, "due:"+local(*t.Due).Format(todoTxtDate))
+		}
+		// Completed tasks lose their (A) prefix, so keep the priority
+		// in the conventional pri: key.
+		if letter, ok := todoTxtPriorities[t.Priority]; ok && t.isDone() {
+			parts = append(parts, "pri:"+letter)
+		}
+		if st := t.status(); st != StatusTodo && st != StatusDone {
+			parts = append(parts, "status:"+string(st))
+		}
+		if t.Recur != nil {
+			parts = append(parts, "rec:"+t.Recur.String())
+		}
+		if t.ParentID != "" {
+			parts = append(parts, "parent:"+t.ParentID)
+		}
+		if len(t.BlockedBy) > 0 {
+			parts = append(parts, "dep:"+strings.Join(t.BlockedBy, ","))
+		}
+		if t.ID != "" {
+			parts = append(parts, "id:"+t.ID)
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(parts, " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var todoTxtPriorityPattern = regexp.MustCompile(`^\(([A-Z])\)$`)
+
+func parseTodoTxtDate(s string) (time.Time, bool) {
+	t, err := time.ParseInLocation(todoTxtDate, s, zone())
+	return t, err == nil
+}
+
+func readTodoTxt(r io.Reader) (Todos, error) {
+	var todos Todos
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		t := Todo{Status: StatusTodo}
+		if fields[0] == "x" {
+			t.Status = StatusDone
+			fields = fields[1:]
+		}
+		if len(fields) > 0 {
+			if m := todoTxtPriorityPattern.FindStringSubmatch(fields[0]); m != nil {
+				t.Priority = todoTxtPriority(m[1])
+				fields = fields[1:]
+			}
+		}
+		// A completed task may carry a completion date, and any task a
+		// creation date after that.
+		if t.isDone() && len(fields) > 0 {
+			if done, ok := parseTodoTxtDate(fields[0]); ok {
+				t.Transitions = []Transition{{Status: StatusDone, At: done}}
+				fields = fields[1:]
+			}
+		}
+		if len(fields) > 0 {
+			if created, ok := parseTodoTxtDate(fields[0]); ok {
+				t.CreatedAt = created
+				fields = fields[1:]
+			}
+		}
+
+		var words, tags []string
+		for _, f := range fields {
+			key, value, isKV := strings.Cut(f, ":")
+			switch {
+			case strings.HasPrefix(f, "+") && len(f) > 1:
+				tags = append(tags, f[1:])
+			case strings.HasPrefix(f, "@") && len(f) > 1:
+				tags = append(tags, f)
+			case isKV && key == "due":
+				if due, ok := parseTodoTxtDate(value); ok {
+					due = due.AddDate(0, 0, 1).Add(-time.Second)
+					t.Due = &due
+					continue
+				}
+				words = append(words, f)
+			case isKV && key == "pri" && len(value) == 1:
+				t.Priority = todoTxtPriority(value)
+			case isKV && key == "rec":
+				// Only our own repeat rules are understood; rec: values
+				// written by other tools stay in the title.
+				if r, err := parseRecurrence(value); err == nil && r != nil {
+					t.Recur = r
+					continue
+				}
+				words = append(words, f)
+			case isKV && key == "status" && !t.isDone():
+				if st, err := parseStatus(value); err == nil {
+					t.Status = st
+					continue
+				}
+				words = append(words, f)
+			case isKV && key == "dep" && value != "":
+				for _, id := range strings.Split(value, ",") {
+					t.BlockedBy = append(t.BlockedBy, normalizeID(id))
+				}
+			case isKV && key == "parent" && value != "":
+				t.ParentID = normalizeID(value)
+			case isKV && key == "id" && value != "":
+				t.ID = normalizeID(value)
+			default:
+				words = append(words, f)
+			}
+		}
+		t.Title = strings.Join(words, " ")
+		t.Tags = normalizeTags(tags)
+		todos = append(todos, t)
+	}
+	return todos, scanner.Err()
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+	"time"
+)
+
+// exchangeSample returns a list using every field the exchange formats know
+// about: a parent with a done subtask, and a todo blocked by the parent.
+func exchangeSample(loc *time.Location) Todos {
+	created := time.Date(2024, time.March, 1, 9, 30, 0, 0, loc)
+	done := time.Date(2024, time.March, 4, 16, 45, 0, 0, loc)
+	due := time.Date(2024, time.March, 8, 23, 59, 59, 0, loc)
+	return Todos{
+		{
+			ID: "a2b3", Title: "Plan the trip", Status: StatusInProgress, CreatedAt: created,
+			Transitions: []Transition{{StatusTodo, created}, {StatusInProgress, done}},
+			Due:         &due, Priority: PriorityHigh, Tags: []string{"travel", "@home"},
+			Recur: &Recurrence{Kind: RepeatWeekly, Interval: 1, Weekdays: []time.Weekday{time.Monday, time.Thursday}},
+		},
+		{
+			ID: "c4d5", Title: "Book flights", Status: StatusDone, CreatedAt: created,
+			Transitions: []Transition{{StatusTodo, created}, {StatusDone, done}},
+			Priority:    PriorityLow, ParentID: "a2b3",
+		},
+		{
+			ID: "e6f7", Title: "Pack", Status: StatusTodo, CreatedAt: created,
+			Transitions: []Transition{{StatusTodo, created}},
+			BlockedBy:   []string{"a2b3"},
+		},
+	}
+}
+
+func roundTrip(t *testing.T, format string, todos Todos) Todos {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := exportTodos(&buf, format, todos); err != nil {
+		t.Fatal(err)
+	}
+	got, err := importTodos(&buf, format)
+	if err != nil {
+		t.Fatalf("importing %s:\n%s\n%v", format, buf.String(), err)
+	}
+	if len(got) != len(todos) {
+		t.Fatalf("%s round trip gave %d todos, want %d", format, len(got), len(todos))
+	}
+	return got
+}
+
+func equalTimePtr(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	loc := newYork(t)
+	pinClock(t, time.Date(2024, time.March, 6, 10, 0, 0, 0, loc))
+	want := exchangeSample(loc)
+
+	// CSV keeps every field; of the history only the completion time.
+	for i, got := range roundTrip(t, "csv", want) {
+		w := want[i]
+		if got.ID != w.ID || got.Title != w.Title || got.Status != w.Status ||
+			!got.CreatedAt.Equal(w.CreatedAt) || !equalTimePtr(got.completedAt(), w.completedAt()) ||
+			!equalTimePtr(got.Due, w.Due) || got.Priority != w.Priority ||
+			!slices.Equal(got.Tags, w.Tags) || recurrenceString(got.Recur) != recurrenceString(w.Recur) ||
+			got.ParentID != w.ParentID || !slices.Equal(got.BlockedBy, w.BlockedBy) {
+			t.Errorf("todo %d:\n got %+v\nwant %+v", i, got, w)
+		}
+	}
+}
+
+func TestMarkdownRoundTrip(t *testing.T) {
+	loc := newYork(t)
+	pinClock(t, time.Date(2024, time.March, 6, 10, 0, 0, 0, loc))
+	want := exchangeSample(loc)
+
+	// Markdown keeps the title, whether a todo is done and the nesting;
+	// IDs are made up on import.
+	got := roundTrip(t, "markdown", want)
+	titles := map[string]string{}
+	for _, g := range got {
+		titles[g.ID] = g.Title
+	}
+	for i, title := range []string{"Plan the trip", "Book flights", "Pack"} {
+		g := got[i]
+		w := want[slices.IndexFunc(want, func(t Todo) bool { return t.Title == title })]
+		if g.Title != title || g.isDone() != w.isDone() {
+			t.Errorf("todo %d = %q (done %v), want %q (done %v)", i, g.Title, g.isDone(), title, w.isDone())
+		}
+		wantParent := ""
+		if w.ParentID != "" {
+			wantParent = "Plan the trip"
+		}
+		if titles[g.ParentID] != wantParent {
+			t.Errorf("%q has parent %q, want %q", g.Title, titles[g.ParentID], wantParent)
+		}
+		if g.Due != nil || g.Priority != "" || len(g.Tags) > 0 || len(g.BlockedBy) > 0 {
+			t.Errorf("%q gained fields markdown doesn't have: %+v", g.Title, g)
+		}
+	}
+}
+
+func TestTodoTxtRoundTrip(t *testing.T) {
+	loc := newYork(t)
+	pinClock(t, time.Date(2024, time.March, 6, 10, 0, 0, 0, loc))
+	want := exchangeSample(loc)
+	day := func(t time.Time) time.Time {
+		y, m, d := t.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, loc)
+	}
+
+	// todo.txt keeps every field, but creation and completion times only
+	// to the day and due dates as the end of their day.
+	for i, got := range roundTrip(t, "todotxt", want) {
+		w := want[i]
+		if got.ID != w.ID || got.Title != w.Title || got.status() != w.status() ||
+			got.Priority != w.Priority || !slices.Equal(got.Tags, w.Tags) ||
+			recurrenceString(got.Recur) != recurrenceString(w.Recur) ||
+			got.ParentID != w.ParentID || !slices.Equal(got.BlockedBy, w.BlockedBy) {
+			t.Errorf("todo %d:\n got %+v\nwant %+v", i, got, w)
+		}
+		if !got.CreatedAt.Equal(day(w.CreatedAt)) {
+			t.Errorf("todo %d created %v, want %v", i, got.CreatedAt, day(w.CreatedAt))
+		}
+		if at := w.completedAt(); at != nil {
+			if c := got.completedAt(); c == nil || !c.Equal(day(*at)) {
+				t.Errorf("todo %d completed %v, want %v", i, c, day(*at))
+			}
+		}
+		if !equalTimePtr(got.Due, w.Due) {
+			t.Errorf("todo %d due %v, want %v", i, got.Due, w.Due)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+type Priority string
+
+const (
+	PriorityNone   Priority = ""
+	PriorityLow    Priority = "low"
+	PriorityMedium Priority = "medium"
+	PriorityHigh   Priority = "high"
+)
+
+func parsePriority(s string) (Priority, error) {
+	switch p := Priority(strings.ToLower(strings.TrimSpace(s))); p {
+	case PriorityLow, PriorityMedium, PriorityHigh:
+		return p, nil
+	case "none", "":
+		return PriorityNone, nil
+	default:
+		return PriorityNone, fmt.Errorf("invalid priority %q (want low, medium, high or none)", s)
+	}
+}
+
+// rank orders priorities from none (0) to high (3).
+func (p Priority) rank() int {
+	switch p {
+	case PriorityLow:
+		return 1
+	case PriorityMedium:
+		return 2
+	case PriorityHigh:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// normalizeTags splits comma separated values, lowercases them and drops
+// empty entries and duplicates.
+func normalizeTags(values []string) []string {
+	var tags []string
+	for _, v := range values {
+		for _, tag := range strings.Split(v, ",") {
+			tag = strings.ToLower(strings.TrimSpace(tag))
+			if tag != "" && !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+func (t Todo) hasTag(tag string) bool {
+	return slices.Contains(t.Tags, strings.ToLower(tag))
+}
+
+func (t Todo) isOverdue(now time.Time) bool {
+	return !t.isClosed() && t.Due != nil && t.Due.Before(now)
+}
+
+// listOptions selects, orders and formats the todos shown by print.
+type listOptions struct {
+	Tag      string
+	Priority Priority
+	Status   Status
+	Overdue  bool
+	// HideBlocked leaves out todos with open blockers.
+	HideBlocked bool
+	SortBy      string
+	Kanban      bool
+
+	Output string
+	// Template, when set, replaces the table and Output.
+	Template   *template.Template
+	ASCII      bool
+	Color      bool
+	TimeFormat string
+}
+
+var sortKeys = []string{"", "due", "priority", "created"}
+
+// filter returns the todos matching opts in the requested order. The
+// receiver is left untouched.
+func (todos *Todos) filter(opts listOptions, now time.Time) Todos {
+	var result Todos
+	for _, t := range *todos {
+		if opts.Tag != "" && !t.hasTag(opts.Tag) {
+			continue
+		}
+		if opts.Priority != PriorityNone && t.Priority != opts.Priority {
+			continue
+		}
+		if opts.Status != "" && t.status() != opts.Status {
+			continue
+		}
+		if opts.Overdue && !t.isOverdue(now) {
+			continue
+		}
+		if opts.HideBlocked && todos.isBlocked(t) {
+			continue
+		}
+		result = append(result, t)
+	}
+
+	if less := sortLess(opts.SortBy); less != nil {
+		sort.SliceStable(result, func(i, j int) bool { return less(result[i], result[j]) })
+	}
+	return result
+}
+
+// sortLess returns the ordering for a sort key, or nil to keep list order.
+func sortLess(key string) func(a, b Todo) bool {
+	switch key {
+	case "due":
+		// Todos without a due date go last.
+		return func(a, b Todo) bool {
+			if a.Due == nil || b.Due == nil {
+				return a.Due != nil
+			}
+			return a.Due.Before(*b.Due)
+		}
+	case "priority":
+		return func(a, b Todo) bool {
+			return a.Priority.rank() > b.Priority.rank()
+		}
+	case "created":
+		return func(a, b Todo) bool {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+	}
+	return nil
+}
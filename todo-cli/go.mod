@@ -3,9 +3,13 @@ module todo
 go 1.24.0
 
 require (
-	github.com/aquasecurity/table v1.8.0 // indirect
+	github.com/aquasecurity/table v1.8.0
+	golang.org/x/crypto v0.36.0
+	golang.org/x/term v0.30.0
+)
+
+require (
 	github.com/mattn/go-runewidth v0.0.13 // indirect
 	github.com/rivo/uniseg v0.2.0 // indirect
-	golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1 // indirect
-	golang.org/x/term v0.0.0-20220526004731-065cf7ba2467 // indirect
+	golang.org/x/sys v0.31.0 // indirect
 )
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sort"
+	"time"
+)
+
+// historyLimit bounds the number of operations kept for undo and for redo.
+const historyLimit = 50
+
+// ErrNothingToUndo is returned by undo when the history is empty.
+var ErrNothingToUndo = errors.New("nothing to undo")
+
+// ErrNothingToRedo is returned by redo when no undone operation is left.
+var ErrNothingToRedo = errors.New("nothing to redo")
+
+// historyFile returns the name of the undo history kept next to a todo file.
+func historyFile(todoFile string) string {
+	return todoFile + ".history"
+}
+
+// change describes one todo before and after an operation. A nil Before
+// means the todo was created, a nil After that it was deleted. The indexes
+// are the todo's positions in the list, or -1 when it was absent.
+type change struct {
+	ID          string
+	BeforeIndex int
+	AfterIndex  int
+	Before      *Todo `json:",omitempty"`
+	After       *Todo `json:",omitempty"`
+}
+
+// operation is one recorded mutation and everything it changed.
+type operation struct {
+	Name    string
+	At      time.Time
+	Changes []change
+}
+
+// History is the undo journal stored next to a todo list.
+type History struct {
+	Undo []operation
+	Redo []operation
+}
+
+// record adds the difference between before and after as a new operation.
+// Any redo history is dropped, as it no longer applies.
+func (h *History) record(name string, before, after Todos) {
+	changes := diffTodos(before, after)
+	if len(changes) == 0 {
+		return
+	}
+	h.Undo = pushBounded(h.Undo, operation{Name: name, At: clock(), Changes: changes})
+	h.Redo = nil
+}
+
+// undo reverts the most recent operation and returns it.
+func (h *History) undo(todos *Todos) (operation, error) {
+	if len(h.Undo) == 0 {
+		return operation{}, ErrNothingToUndo
+	}
+	op := h.Undo[len(h.Undo)-1]
+	h.Undo = h.Undo[:len(h.Undo)-1]
+
+	todos.apply(op.Changes, false)
+	h.Redo = pushBounded(h.Redo, op)
+	return op, nil
+}
+
+// redo applies the most recently undone operation again and returns it.
+func (h *History) redo(todos *Todos) (operation, error) {
+	if len(h.Redo) == 0 {
+		return operation{}, ErrNothingToRedo
+	}
+	op := h.Redo[len(h.Redo)-1]
+	h.Redo = h.Redo[:len(h.Redo)-1]
+
+	todos.apply(op.Changes, true)
+	h.Undo = pushBounded(h.Undo, op)
+	return op, nil
+}
+
+func pushBounded(ops []operation, op operation) []operation {
+	ops = append(ops, op)
+	if len(ops) > historyLimit {
+		ops = slices.Delete(ops, 0, len(ops)-historyLimit)
+	}
+	return ops
+}
+
+// cloneTodos returns a deep copy of todos, so later mutations through
+// pointers or shared slices don't leak into it.
+func cloneTodos(todos Todos) Todos {
+	data, err := json.Marshal(todos)
+	if err != nil {
+		panic(err)
+	}
+	var clone Todos
+	if err := json.Unmarshal(data, &clone); err != nil {
+		panic(err)
+	}
+	return clone
+}
+
+func sameTodo(a, b Todo) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return bytes.Equal(ja, jb)
+}
+
+// diffTodos lists the todos that were created, deleted, modified or moved
+// between before and after. A todo counts as moved when its rank among the
+// todos present in both lists changed; plain index shifts caused by
+// insertions and deletions elsewhere are not recorded.
+func diffTodos(before, after Todos) []change {
+	beforeIndex := map[string]int{}
+	for i, t := range before {
+		beforeIndex[t.ID] = i
+	}
+	afterIndex := map[string]int{}
+	for i, t := range after {
+		afterIndex[t.ID] = i
+	}
+
+	var beforeOrder, afterOrder []string
+	for _, t := range before {
+		if _, ok := afterIndex[t.ID]; ok {
+			beforeOrder = append(beforeOrder, t.ID)
+		}
+	}
+	for _, t := range after {
+		if _, ok := beforeIndex[t.ID]; ok {
+			afterOrder = append(afterOrder, t.ID)
+		}
+	}
+	moved := map[string]bool{}
+	for k := range beforeOrder {
+		if beforeOrder[k] != afterOrder[k] {
+			moved[beforeOrder[k]] = true
+		}
+	}
+
+	var changes []change
+	for i := range before {
+		b := &before[i]
+		c := change{ID: b.ID, BeforeIndex: i, AfterIndex: -1, Before: b}
+		if j, ok := afterIndex[b.ID]; ok {
+			if !moved[b.ID] && sameTodo(*b, after[j]) {
+				continue
+			}
+			c.AfterIndex = j
+			c.After = &after[j]
+		}
+		changes = append(changes, c)
+	}
+	for j := range after {
+		if _, ok := beforeIndex[after[j].ID]; !ok {
+			changes = append(changes, change{ID: after[j].ID, BeforeIndex: -1, AfterIndex: j, After: &after[j]})
+		}
+	}
+	return changes
+}
+
+// apply rewinds (forward false) or replays (forward true) changes: every
+// todo involved is removed and then re-inserted at its target position. The
+// remaining todos keep their relative order, so inserting in ascending index
+// order restores the recorded list exactly.
+func (todos *Todos) apply(changes []change, forward bool) {
+	involved := map[string]bool{}
+	type placement struct {
+		index int
+		todo  Todo
+	}
+	var targets []placement
+
+	for _, c := range changes {
+		involved[c.ID] = true
+		target, index := c.Before, c.BeforeIndex
+		if forward {
+			target, index = c.After, c.AfterIndex
+		}
+		if target != nil {
+			targets = append(targets, placement{index, *target})
+		}
+	}
+
+	*todos = slices.DeleteFunc(*todos, func(t Todo) bool { return involved[t.ID] })
+
+	sort.Slice(targets, func(i, j int) bool { return targets[i].index < targets[j].index })
+	for _, p := range targets {
+		index := min(max(p.index, 0), len(*todos))
+		*todos = slices.Insert(*todos, index, p.todo)
+	}
+}
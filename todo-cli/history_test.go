@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestDiffApplyRoundTrip(t *testing.T) {
+	a := Todo{ID: "aaaa", Title: "a", Status: StatusTodo}
+	b := Todo{ID: "bbbb", Title: "b", Status: StatusTodo}
+	c := Todo{ID: "cccc", Title: "c", Status: StatusTodo}
+	d := Todo{ID: "dddd", Title: "d", Status: StatusTodo}
+	renamed := b
+	renamed.Title = "b2"
+
+	tests := []struct {
+		name          string
+		before, after Todos
+		changes       int
+	}{
+		{"nothing", Todos{a, b, c}, Todos{a, b, c}, 0},
+		{"insert at the end", Todos{a, b}, Todos{a, b, c}, 1},
+		{"insert in the middle", Todos{a, c}, Todos{a, b, c}, 1},
+		{"insert first", Todos{b, c}, Todos{a, b, c}, 1},
+		{"insert several", Todos{b}, Todos{a, b, c, d}, 3},
+		{"delete first", Todos{a, b, c}, Todos{b, c}, 1},
+		{"delete in the middle", Todos{a, b, c}, Todos{a, c}, 1},
+		{"delete everything", Todos{a, b, c}, Todos{}, 3},
+		{"modify", Todos{a, b, c}, Todos{a, renamed, c}, 1},
+		{"swap", Todos{a, b, c}, Todos{b, a, c}, 2},
+		{"move last to first", Todos{a, b, c, d}, Todos{d, a, b, c}, 4},
+		{"reverse", Todos{a, b, c, d}, Todos{d, c, b, a}, 4},
+		{"move, modify and insert", Todos{a, b, c}, Todos{c, d, renamed}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := diffTodos(cloneTodos(tt.before), cloneTodos(tt.after))
+			if len(changes) != tt.changes {
+				t.Errorf("diffTodos recorded %d change(s), want %d: %+v", len(changes), tt.changes, changes)
+			}
+
+			todos := cloneTodos(tt.after)
+			todos.apply(changes, false)
+			if !sameTodoList(todos, tt.before) {
+				t.Errorf("rewinding gave %v, want %v", titles(todos), titles(tt.before))
+			}
+			todos.apply(changes, true)
+			if !sameTodoList(todos, tt.after) {
+				t.Errorf("replaying gave %v, want %v", titles(todos), titles(tt.after))
+			}
+		})
+	}
+}
+
+func titles(todos Todos) []string {
+	var ts []string
+	for _, t := range todos {
+		ts = append(ts, t.Title)
+	}
+	return ts
+}
+
+func TestUndoRedo(t *testing.T) {
+	var h History
+	var todos Todos
+	var states []Todos
+	for i := range 3 {
+		before := cloneTodos(todos)
+		todos = append(todos, Todo{ID: fmt.Sprintf("id%02d", i), Title: fmt.Sprint(i)})
+		h.record("add", before, todos)
+		states = append(states, cloneTodos(todos))
+	}
+
+	for i := 1; i >= 0; i-- {
+		if _, err := h.undo(&todos); err != nil {
+			t.Fatal(err)
+		}
+		if !sameTodoList(todos, states[i]) {
+			t.Fatalf("undo gave %v, want %v", titles(todos), titles(states[i]))
+		}
+	}
+	if _, err := h.undo(&todos); err != nil || len(todos) != 0 {
+		t.Fatalf("undoing the first add gave %v, %v", titles(todos), err)
+	}
+	if _, err := h.undo(&todos); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("undo with an empty history = %v, want %v", err, ErrNothingToUndo)
+	}
+
+	for i := range 2 {
+		if _, err := h.redo(&todos); err != nil {
+			t.Fatal(err)
+		}
+		if !sameTodoList(todos, states[i]) {
+			t.Fatalf("redo gave %v, want %v", titles(todos), titles(states[i]))
+		}
+	}
+
+	// A new change drops what is left to redo.
+	before := cloneTodos(todos)
+	todos[0].Title = "changed"
+	h.record("edit", before, todos)
+	if _, err := h.redo(&todos); !errors.Is(err, ErrNothingToRedo) {
+		t.Errorf("redo after a new change = %v, want %v", err, ErrNothingToRedo)
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	var h History
+	todos := Todos{{ID: "aaaa", Title: "0"}}
+	for i := 1; i <= historyLimit+10; i++ {
+		before := cloneTodos(todos)
+		todos[0].Title = fmt.Sprint(i)
+		h.record("edit", before, todos)
+	}
+	if len(h.Undo) != historyLimit {
+		t.Fatalf("kept %d operations, want %d", len(h.Undo), historyLimit)
+	}
+	// The oldest operations were dropped: undoing everything that is
+	// left goes back to title 10, not 0.
+	for range historyLimit {
+		if _, err := h.undo(&todos); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if todos[0].Title != "10" {
+		t.Errorf("undoing all kept operations gave title %q, want 10", todos[0].Title)
+	}
+	if len(h.Redo) != historyLimit {
+		t.Errorf("redo holds %d operations, want %d", len(h.Redo), historyLimit)
+	}
+
+	// Redo is bounded the same way, keeping the operations pushed last.
+	h.Undo = nil
+	for i := range historyLimit + 5 {
+		h.Undo = append(h.Undo, operation{Name: fmt.Sprint(i)})
+	}
+	h.Redo = nil
+	for range historyLimit + 5 {
+		h.undo(&Todos{})
+	}
+	// Undoing 54 down to 0 pushed them in that order; the first pushed
+	// are the ones dropped.
+	if len(h.Redo) != historyLimit || h.Redo[0].Name != "49" || h.Redo[historyLimit-1].Name != "0" {
+		t.Errorf("redo holds %d operations from %q to %q, want %d from 49 to 0",
+			len(h.Redo), h.Redo[0].Name, h.Redo[len(h.Redo)-1].Name, historyLimit)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"crypto/rand"
+	"strings"
+)
+
+// idAlphabet leaves out characters that are easily confused when typed or
+// read back (0/o, 1/l/i).
+const idAlphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+
+const idLength = 4
+
+func randomID(length int) string {
+	buf := make([]byte, length)
+	rand.Read(buf)
+	for i, b := range buf {
+		buf[i] = idAlphabet[int(b)%len(idAlphabet)]
+	}
+	return string(buf)
+}
+
+// newID returns a short ID not yet used by any of todos. IDs grow longer if
+// the short space gets crowded.
+func (todos *Todos) newID() string {
+	used := make(map[string]bool, len(*todos))
+	for _, t := range *todos {
+		used[t.ID] = true
+	}
+
+	length := idLength
+	for {
+		for attempt := 0; attempt < 10; attempt++ {
+			id := randomID(length)
+			if !used[id] {
+				return id
+			}
+		}
+		length++
+	}
+}
+
+func normalizeID(id string) string {
+	return strings.ToLower(strings.TrimSpace(id))
+}
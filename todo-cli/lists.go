@@ -0,0 +1,461 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aquasecurity/table"
+)
+
+// defaultList is used when no list was selected or switched to, unless the
+// configuration names another. Its file, todos.json, is where todo-cli kept
+// its only list before lists existed.
+const defaultList = "todos"
+
+// currentListFile records the list chosen with "lists switch".
+const currentListFile = ".todo-current"
+
+var listNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// ErrListExists is returned when creating or renaming onto an existing list.
+var ErrListExists = errors.New("list already exists")
+
+// ErrListNotFound is returned for operations on a list that doesn't exist.
+var ErrListNotFound = errors.New("list not found")
+
+func validateListName(name string) error {
+	if !listNamePattern.MatchString(name) || strings.HasSuffix(name, ".json") {
+		return usagef("invalid list name %q (use letters, digits, '-', '_' and '.')", name)
+	}
+	return nil
+}
+
+func listFile(name string) string {
+	return filepath.Join(global.config.DataDir, name+".json")
+}
+
+func listExists(name string) bool {
+	_, err := os.Stat(listFile(name))
+	return err == nil
+}
+
+// currentList returns the list chosen with "lists switch", or the configured
+// default list.
+func currentList() string {
+	data, err := os.ReadFile(filepath.Join(global.config.DataDir, currentListFile))
+	if name := strings.TrimSpace(string(data)); err == nil && name != "" {
+		return name
+	}
+	return global.config.DefaultList
+}
+
+// activeList returns the list commands operate on: the one given with
+// --list, or else the current list.
+func activeList() (string, error) {
+	name := global.list
+	if name == "" {
+		name = currentList()
+	}
+	if err := validateListName(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// listNames returns the names of all lists in the data directory. JSON files
+// that don't hold a todo list are skipped.
+func listNames() ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(global.config.DataDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, m := range matches {
+		if isTodoList(m) {
+			names = append(names, strings.TrimSuffix(filepath.Base(m), ".json"))
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// isTodoList reports whether fileName holds a todo list: encrypted data, a
+// todo envelope, or a bare array of todos as written before envelopes
+// existed. Other JSON files in the data directory are left alone.
+func isTodoList(fileName string) bool {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return false
+	}
+	if isSealed(data) {
+		return true
+	}
+	payload, version := unwrap(data)
+	if version > 0 {
+		var todos []json.RawMessage
+		return json.Unmarshal(payload, &todos) == nil
+	}
+	// A version 0 list is an array of objects that each have a Title and
+	// a CreatedAt.
+	var items []map[string]json.RawMessage
+	if json.Unmarshal(payload, &items) != nil || items == nil {
+		return false
+	}
+	for _, item := range items {
+		if item["Title"] == nil || item["CreatedAt"] == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// listFiles returns the files belonging to a list, including ones that may
+// not exist.
+func listFiles(name string) []string {
+	f := listFile(name)
+	return []string{f, historyFile(f), f + ".lock"}
+}
+
+func cmdLists() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("lists", "[show|create|switch|rename|delete] [NAME...]", "Show the todo lists, or manage them with a subcommand.")
+	return fs, func(rest []string) error {
+		if len(rest) > 0 {
+			return usagef("unknown subcommand %q", rest[0])
+		}
+
+		names, err := listNames()
+		if err != nil {
+			return err
+		}
+		current := currentList()
+		if !slices.Contains(names, current) {
+			names = append([]string{current}, names...)
+		}
+
+		for _, name := range names {
+			var open, total int
+			err := viewStoreFile(listFile(name), func(todos Todos) error {
+				total = len(todos)
+				for _, t := range todos {
+					if !t.isClosed() {
+						open++
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			marker := " "
+			if name == current {
+				marker = "*"
+			}
+			fmt.Printf("%s %-20s %d open / %d total\n", marker, name, open, total)
+		}
+		return nil
+	}
+}
+
+func listsCreate() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("lists create", "NAME", "Create an empty todo list.")
+	return fs, func(rest []string) error {
+		var err error
+		if len(rest) != 1 {
+			return usagef("expected exactly one list name")
+		}
+		name := rest[0]
+		if err := validateListName(name); err != nil {
+			return err
+		}
+		if listExists(name) {
+			return fmt.Errorf("%w: %q", ErrListExists, name)
+		}
+		if err := os.MkdirAll(global.config.DataDir, 0755); err != nil {
+			return err
+		}
+
+		err = withStoreFile(listFile(name), true, func(*Todos, *History) error { return nil })
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created list %s\n", name)
+		return nil
+	}
+}
+
+func listsSwitch() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("lists switch", "NAME", "Make NAME the current todo list.")
+	return fs, func(rest []string) error {
+		if len(rest) != 1 {
+			return usagef("expected exactly one list name")
+		}
+		name := rest[0]
+		if err := validateListName(name); err != nil {
+			return err
+		}
+		if !listExists(name) && name != global.config.DefaultList {
+			return fmt.Errorf("%w: %q (create it with \"lists create\")", ErrListNotFound, name)
+		}
+
+		if err := setCurrentList(name); err != nil {
+			return err
+		}
+		fmt.Printf("Switched to list %s\n", name)
+		return nil
+	}
+}
+
+func setCurrentList(name string) error {
+	if err := os.MkdirAll(global.config.DataDir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(global.config.DataDir, currentListFile), []byte(name+"\n"), 0644)
+}
+
+func listsRename() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("lists rename", "OLD NEW", "Rename a todo list.")
+	return fs, func(rest []string) error {
+		if len(rest) != 2 {
+			return usagef("expected the old and the new list name")
+		}
+		from, to := rest[0], rest[1]
+		for _, name := range rest {
+			if err := validateListName(name); err != nil {
+				return err
+			}
+		}
+		if !listExists(from) {
+			return fmt.Errorf("%w: %q", ErrListNotFound, from)
+		}
+		if listExists(to) {
+			return fmt.Errorf("%w: %q", ErrListExists, to)
+		}
+
+		if err := renameList(from, to); err != nil {
+			return err
+		}
+		// Anyone still waiting on the old lock file notices it is gone, see
+		// lockFile.
+		os.Remove(listFile(from) + ".lock")
+
+		if currentList() == from {
+			if err := setCurrentList(to); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("Renamed list %s to %s\n", from, to)
+		return nil
+	}
+}
+
+// renameList moves the files of list from to list to. It holds both lists'
+// locks, so no one writes to the old list while it moves and two renames
+// can't both claim the new name.
+func renameList(from, to string) (err error) {
+	// Taking the locks in name order keeps renames between the same two
+	// lists from deadlocking.
+	names := []string{from, to}
+	slices.Sort(names)
+	for _, name := range slices.Compact(names) {
+		unlock, err := newTodoStorage(listFile(name)).Lock()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if uerr := unlock(); err == nil {
+				err = uerr
+			}
+		}()
+	}
+	if !listExists(from) {
+		return fmt.Errorf("%w: %q", ErrListNotFound, from)
+	}
+	if listExists(to) {
+		return fmt.Errorf("%w: %q", ErrListExists, to)
+	}
+
+	oldFiles, newFiles := listFiles(from)[:2], listFiles(to)[:2]
+	backups, err := listBackups(from)
+	if err != nil {
+		return err
+	}
+	for _, b := range backups {
+		oldFiles = append(oldFiles, b)
+		newFiles = append(newFiles, listFile(to)+strings.TrimPrefix(b, listFile(from)))
+	}
+	// The lock files stay behind until the locks are released.
+	for i := range oldFiles {
+		if err := os.Rename(oldFiles[i], newFiles[i]); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(listArchiveDir(from), listArchiveDir(to)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// listBackups returns the copies of a list and its history that schema
+// migrations kept, such as todos.json.v1.bak.
+func listBackups(name string) ([]string, error) {
+	entries, err := os.ReadDir(global.config.DataDir)
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, f := range listFiles(name)[:2] {
+		prefix := filepath.Base(f) + ".v"
+		for _, e := range entries {
+			if strings.HasPrefix(e.Name(), prefix) && strings.HasSuffix(e.Name(), ".bak") {
+				backups = append(backups, filepath.Join(filepath.Dir(f), e.Name()))
+			}
+		}
+	}
+	return backups, nil
+}
+
+func listsDelete() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("lists delete", "NAME", "Delete a todo list, its undo history and its archive.")
+	force := fs.Bool("force", false, "delete even if the list has open todos")
+	return fs, func(rest []string) error {
+		var err error
+		if len(rest) != 1 {
+			return usagef("expected exactly one list name")
+		}
+		name := rest[0]
+		if err := validateListName(name); err != nil {
+			return err
+		}
+		if !listExists(name) {
+			return fmt.Errorf("%w: %q", ErrListNotFound, name)
+		}
+
+		err = withStoreFile(listFile(name), false, func(todos *Todos, _ *History) error {
+			for _, t := range *todos {
+				if !t.isClosed() && !*force {
+					return fmt.Errorf("list %q has open todos; use --force to delete it anyway", name)
+				}
+			}
+			for _, f := range listFiles(name)[:2] {
+				if err := os.Remove(f); err != nil && !errors.Is(err, os.ErrNotExist) {
+					return err
+				}
+			}
+			return os.RemoveAll(listArchiveDir(name))
+		})
+		if err != nil {
+			return err
+		}
+		// Waiters move on to a new lock file, see lockFile.
+		os.Remove(listFile(name) + ".lock")
+
+		if currentList() == name {
+			if err := setCurrentList(global.config.DefaultList); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("Deleted list %s\n", name)
+		return nil
+	}
+}
+
+// listedTodo is a todo together with the list it belongs to.
+type listedTodo struct {
+	List string
+	Todo
+}
+
+func cmdAll() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("all", "", "Show the open todos of every list.")
+	var opts listOptions
+	fs.StringVar(&opts.Tag, "tag", "", "only show todos with this tag")
+	priority := fs.String("priority", "", "only show todos with this priority")
+	fs.BoolVar(&opts.Overdue, "overdue", false, "only show todos past their due date")
+	fs.StringVar(&opts.SortBy, "sort", "due", "sort by due, priority or created")
+	fs.StringVar(&opts.Output, "output", "table", "output format: table, json or jsonl")
+	fs.BoolVar(&opts.ASCII, "ascii", false, "use plain ASCII box drawing characters")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	return fs, func(rest []string) error {
+		var err error
+		if len(rest) > 0 {
+			return usagef("unexpected arguments: %v", rest)
+		}
+		if opts.Priority, err = parsePriority(*priority); err != nil {
+			return usagef("%v", err)
+		}
+		if !slices.Contains(sortKeys, opts.SortBy) {
+			return usagef("invalid sort key %q (want due, priority or created)", opts.SortBy)
+		}
+		if !slices.Contains([]string{"table", "json", "jsonl"}, opts.Output) {
+			return usagef("invalid output format %q (want table, json or jsonl)", opts.Output)
+		}
+		opts.Color = !*noColor && colorEnabled(os.Stdout)
+
+		names, err := listNames()
+		if err != nil {
+			return err
+		}
+		now := clock()
+		var rows []listedTodo
+		for _, name := range names {
+			err := viewStoreFile(listFile(name), func(todos Todos) error {
+				for _, t := range todos.filter(opts, now) {
+					if !t.isClosed() {
+						rows = append(rows, listedTodo{List: name, Todo: t})
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if less := sortLess(opts.SortBy); less != nil {
+			sort.SliceStable(rows, func(i, j int) bool { return less(rows[i].Todo, rows[j].Todo) })
+		}
+
+		switch opts.Output {
+		case "json":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "    ")
+			return enc.Encode(rows)
+		case "jsonl":
+			enc := json.NewEncoder(os.Stdout)
+			for _, r := range rows {
+				if err := enc.Encode(r); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		dividers := table.UnicodeDividers
+		if opts.ASCII {
+			dividers = table.ASCIIDividers
+		}
+		t := table.New(os.Stdout)
+		t.SetDividers(dividers)
+		t.SetRowLines(false)
+		t.SetHeaders("List", "ID", "Title", "Priority", "Due", "Tags")
+		for _, r := range rows {
+			due := ""
+			if r.Due != nil {
+				due = local(*r.Due).Format(dueFormat)
+				if r.isOverdue(now) {
+					due = opts.colorize(ansiRed, due+" (overdue)")
+				}
+			}
+			t.AddRow(r.List, r.ID, r.Title, string(r.Priority), due, strings.Join(r.Tags, ", "))
+		}
+		t.Render()
+		return nil
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// useDataDir points the data directory at a new temporary directory for the
+// rest of the test.
+func useDataDir(t *testing.T) string {
+	t.Helper()
+	useDefaultConfig(t)
+	global.config.DataDir = t.TempDir()
+	return global.config.DataDir
+}
+
+func TestListsRenameMovesBackups(t *testing.T) {
+	dir := useDataDir(t)
+	writeTodos(t, listFile("work"), Todos{{ID: "a2b3", Title: "report", Status: StatusTodo}}, false)
+	for _, name := range []string{"work.json.v0.bak", "work.json.v1.bak", "work.json.history.v0.bak"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := runCommand(listsRename, []string{"work", "job"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"job.json", "job.json.v0.bak", "job.json.v1.bak", "job.json.history.v0.bak"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s is missing after the rename", name)
+		}
+	}
+	left, _ := filepath.Glob(filepath.Join(dir, "work*"))
+	if len(left) > 0 {
+		t.Errorf("files left behind: %v", left)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "job.json.v1.bak"))
+	if err != nil || string(data) != "work.json.v1.bak" {
+		t.Errorf("job.json.v1.bak = %q, %v; want the old backup", data, err)
+	}
+}
+
+func TestListingLeavesFilesAlone(t *testing.T) {
+	dir := useDataDir(t)
+	files := map[string]string{
+		"users.json":  `[{"name":"alice","age":3}]`,
+		"config.json": `{"version": 1, "data": {"theme": "dark"}}`,
+		"old.json":    `[{"Title":"Buy milk","Completed":false,"CreatedAt":"2024-03-01T09:00:00Z"}]`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names, err := listNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(names, []string{"old"}) {
+		t.Errorf("listNames() = %v, want [old]", names)
+	}
+
+	for _, cmd := range []commandFunc{cmdLists, cmdAll} {
+		if err := runCommand(cmd, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Reading a list takes its shared lock; nothing else is created.
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if _, ok := files[e.Name()]; !ok && e.Name() != "old.json.lock" {
+			t.Errorf("listing created %s", e.Name())
+		}
+	}
+	for name, content := range files {
+		if data, _ := os.ReadFile(filepath.Join(dir, name)); string(data) != content {
+			t.Errorf("listing rewrote %s:\n%s", name, data)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockFile opens (creating if needed) the lock file at path and blocks until
+// it holds an flock on it. Lock files are removed when their list is renamed
+// or deleted; a lock taken on a file that was removed or replaced meanwhile
+// protects nothing, so it is dropped and taken again on the current file.
+func lockFile(path string, exclusive bool) (func() error, error) {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		if err := flock(f, how); err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		held, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		current, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) || err == nil && !os.SameFile(held, current) {
+			f.Close()
+			continue
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		return func() error {
+			defer f.Close()
+			return flock(f, syscall.LOCK_UN)
+		}, nil
+	}
+}
+
+func flock(f *os.File, how int) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), how)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
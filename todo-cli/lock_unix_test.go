@@ -0,0 +1,162 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// addLocked adds one todo to fileName the way commands do: lock, load,
+// change, save.
+func addLocked(fileName, title string) error {
+	store := newTodoStorage(fileName)
+	unlock, err := store.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var todos Todos
+	if err := store.Load(&todos); err != nil {
+		return err
+	}
+	todos.add(title)
+	return store.Save(todos)
+}
+
+func checkCount(t *testing.T, fileName string, want int) {
+	t.Helper()
+	var todos Todos
+	if err := newTodoStorage(fileName).Load(&todos); err != nil {
+		t.Fatal(err)
+	}
+	if len(todos) != want {
+		t.Errorf("%d todos remain, want %d", len(todos), want)
+	}
+}
+
+func TestConcurrentAdds(t *testing.T) {
+	const n = 20
+	file := filepath.Join(t.TempDir(), "todos.json")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- addLocked(file, fmt.Sprintf("todo %d", i))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkCount(t, file, n)
+}
+
+// TestConcurrentAddsProcesses runs the adds in separate processes, each a
+// copy of the test binary running TestAddHelper.
+func TestConcurrentAddsProcesses(t *testing.T) {
+	const n = 8
+	file := filepath.Join(t.TempDir(), "todos.json")
+
+	var cmds []*exec.Cmd
+	for i := range n {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestAddHelper$")
+		cmd.Env = append(os.Environ(), "TODO_TEST_ADD="+file, fmt.Sprintf("TODO_TEST_TITLE=todo %d", i))
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		cmds = append(cmds, cmd)
+	}
+	for _, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkCount(t, file, n)
+}
+
+func TestAddHelper(t *testing.T) {
+	file := os.Getenv("TODO_TEST_ADD")
+	if file == "" {
+		t.Skip("only run by TestConcurrentAddsProcesses")
+	}
+	if err := addLocked(file, os.Getenv("TODO_TEST_TITLE")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListsRenameRechecksUnderLock(t *testing.T) {
+	useDataDir(t)
+	writeTodos(t, listFile("a"), Todos{{ID: "aaaa", Title: "a", Status: StatusTodo}}, false)
+
+	// Someone else holds the new name's lock, and creates the list while
+	// the rename waits for it.
+	unlock, err := newTodoStorage(listFile("c")).Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() { done <- renameList("a", "c") }()
+	time.Sleep(50 * time.Millisecond)
+	writeTodos(t, listFile("c"), Todos{{ID: "cccc", Title: "c", Status: StatusTodo}}, false)
+	unlock()
+
+	if err := <-done; !errors.Is(err, ErrListExists) {
+		t.Fatalf("renameList = %v, want %v", err, ErrListExists)
+	}
+	var todos Todos
+	if err := newTodoStorage(listFile("c")).Load(&todos); err != nil {
+		t.Fatal(err)
+	}
+	if len(todos) != 1 || todos[0].ID != "cccc" || !listExists("a") {
+		t.Errorf("list c = %+v after the failed rename, want it untouched", todos)
+	}
+}
+
+func TestLockFileRemovedWhileWaiting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "todos.json.lock")
+	unlock, err := lockFile(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A waiter blocks on the old file, which is removed, as lists rename
+	// and delete do, before the lock is released.
+	locked := make(chan func() error)
+	go func() {
+		unlock, err := lockFile(path, true)
+		if err != nil {
+			t.Error(err)
+		}
+		locked <- unlock
+	}()
+	time.Sleep(50 * time.Millisecond)
+	os.Remove(path)
+	unlock()
+	waiterUnlock := <-locked
+	defer waiterUnlock()
+
+	// The waiter must hold the lock on the file newcomers use.
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err == nil {
+		t.Error("a new process got the lock while the waiter holds it")
+	}
+}
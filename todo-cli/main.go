@@ -1,12 +1,325 @@
 package main
 
-func main(){
-	todos := Todos{}
-	storage := NewStorage[Todos]("todos.json")
-	storage.Load(&todos)
-	todos.add("Buy milk")
-	todos.add("buy bread")
-	todos.toggle(0)
-	todos.print()
-	storage.Save(todos)
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+const programName = "todo"
+
+// Exit codes returned by run.
+const (
+	exitOK                 = 0
+	exitError              = 1
+	exitUsage              = 2
+	exitNotFound           = 3
+	exitInvalidIndex       = 4
+	exitCorrupt            = 5
+	exitUnsupportedVersion = 6
+	exitIO                 = 7
+	exitConflict           = 8
+)
+
+// exitCode maps an error returned by a command to the process exit code.
+func exitCode(err error) int {
+	var pathErr *fs.PathError
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return exitNotFound
+	case errors.Is(err, ErrInvalidIndex):
+		return exitInvalidIndex
+	case errors.Is(err, ErrCorrupt):
+		return exitCorrupt
+	case errors.Is(err, ErrUnsupportedVersion):
+		return exitUnsupportedVersion
+	case errors.Is(err, ErrMergeConflict):
+		return exitConflict
+	case errors.As(err, &pathErr):
+		return exitIO
+	default:
+		return exitError
+	}
+}
+
+// usageError marks errors caused by bad command line input, so they can be
+// reported together with the usage text.
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+func usagef(format string, args ...any) error {
+	return usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// commandFunc defines the flags of a command and returns them together with
+// the body that runs once they are parsed. Defining the flags does nothing
+// else, so completion can look at them without running the command.
+type commandFunc func() (fs *flag.FlagSet, run func(args []string) error)
+
+// runCommand parses args with the flags of c and runs it. Commands without
+// a flag set get their arguments as they are.
+func runCommand(c commandFunc, args []string) error {
+	fs, run := c()
+	if fs == nil {
+		return run(args)
+	}
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	return run(rest)
+}
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	flags   commandFunc
+	// subs are the subcommands, picked by the first argument. Without
+	// one the command itself runs.
+	subs []subcommand
+}
+
+type subcommand struct {
+	name  string
+	flags commandFunc
+}
+
+// sub returns the subcommand named by the first of args and the arguments
+// left for it, or the command itself and all of args.
+func (c command) sub(args []string) (name string, flags commandFunc, rest []string) {
+	if len(args) > 0 {
+		for _, s := range c.subs {
+			if s.name == args[0] {
+				return s.name, s.flags, args[1:]
+			}
+		}
+	}
+	return "", c.flags, args
+}
+
+func (c command) run(args []string) error {
+	_, flags, rest := c.sub(args)
+	return runCommand(flags, rest)
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"add", "TITLE...", "add a new todo", cmdAdd, nil},
+		{"list", "", "print all todos", cmdList, nil},
+		{"toggle", "ID", "mark a todo as done or back to todo", cmdToggle, nil},
+		{"status", "ID STATUS", "move a todo to another workflow status", cmdStatus, nil},
+		{"start", "ID", "start tracking time on a todo", cmdStart, nil},
+		{"stop", "", "stop the running timer", cmdStop, nil},
+		{"report", "", "summarize tracked time", cmdReport, nil},
+		{"stats", "", "show completion statistics and a burndown chart", cmdStats, nil},
+		{"next", "", "list the todos that can be worked on now", cmdNext, nil},
+		{"snooze", "ID [WHEN...]", "push a todo's due date back", cmdSnooze, nil},
+		{"edit", "ID [TITLE...]", "change the title or details of a todo", cmdEdit, nil},
+		{"delete", "ID", "remove a todo", cmdDelete, nil},
+		{"clear-completed", "", "remove all done and cancelled todos", cmdClearCompleted, nil},
+		{"archive", "[search|restore] [ARGS...]", "move closed todos to the archive, or search and restore them", cmdArchive, []subcommand{
+			{"search", archiveSearch},
+			{"restore", archiveRestore},
+		}},
+		{"export", "[FILE]", "write todos as CSV, Markdown or todo.txt", cmdExport, nil},
+		{"import", "FILE", "add todos from CSV, Markdown or todo.txt", cmdImport, nil},
+		{"merge", "BASE LOCAL REMOTE", "three-way merge two edited copies of a list", cmdMerge, nil},
+		{"undo", "", "revert the last change", cmdUndo, nil},
+		{"redo", "", "reapply the last undone change", cmdRedo, nil},
+		{"history", "", "show changes that can be undone", cmdHistory, nil},
+		{"ui", "", "browse and edit todos interactively", cmdUI, nil},
+		{"rekey", "", "encrypt a list or change its passphrase", cmdRekey, nil},
+		{"lists", "[create|switch|rename|delete] [NAME...]", "show and manage todo lists", cmdLists, []subcommand{
+			{"show", cmdLists},
+			{"create", listsCreate},
+			{"switch", listsSwitch},
+			{"rename", listsRename},
+			{"delete", listsDelete},
+		}},
+		{"config", "[show]", "show the effective settings and where they come from", cmdConfig, []subcommand{
+			{"show", cmdConfig},
+		}},
+		{"all", "", "show open todos from every list", cmdAll, nil},
+		{"completion", "bash|zsh|fish", "print a shell completion script", cmdCompletion, nil},
+	}
+	hiddenCommands = []command{
+		{"__complete", "WORDS...", "print completions for the words of a command line", cmdComplete, nil},
+	}
+}
+
+// hiddenCommands are internal commands left out of the usage text.
+var hiddenCommands []command
+
+func lookupCommand(name string) (command, bool) {
+	for _, c := range append(commands, hiddenCommands...) {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s [--list NAME] [--data-dir DIR] [--color WHEN] <command> [flags] [args]\n\nCommands:\n", programName)
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-16s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(w, "\nEvery command also accepts --list, --data-dir and --color.\n")
+	fmt.Fprintf(w, "Settings are read from %s and TODO_* environment variables;\n", configFile())
+	fmt.Fprintf(w, "run '%s config show' to see them.\n", programName)
+	fmt.Fprintf(w, "\nRun '%s <command> -h' for help on a command.\n", programName)
+}
+
+// global holds the settings and the flags accepted before the command name
+// as well as by every command.
+var global struct {
+	list   string
+	config config
+	// location is the zone of config.Timezone; see zone.
+	location *time.Location
+}
+
+// addGlobalFlags adds the flags every command accepts. Flags that override
+// settings record themselves as the settings' source.
+func addGlobalFlags(fs *flag.FlagSet) {
+	fs.StringVar(&global.list, "list", global.list, "todo list to use (default: the current list)")
+	fs.Func("data-dir", "directory holding the todo lists (default "+global.config.DataDir+")", func(v string) error {
+		return global.config.set("data_dir", v, "flag --data-dir")
+	})
+	fs.Func("color", "when to color output: auto, always or never (default "+global.config.Color+")", func(v string) error {
+		return global.config.set("color", v, "flag --color")
+	})
+}
+
+func run(args []string) int {
+	var err error
+	if global.config, err = loadConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", programName, err)
+		return exitError
+	}
+	// Dates are parsed in the configured zone, and shown in it by way of
+	// local.
+	if global.location, err = global.config.location(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: timezone: %v\n", programName, err)
+		return exitError
+	}
+
+	gfs := flag.NewFlagSet(programName, flag.ContinueOnError)
+	gfs.Usage = func() { printUsage(gfs.Output()) }
+	addGlobalFlags(gfs)
+	if err := gfs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	args = gfs.Args()
+
+	if len(args) == 0 {
+		printUsage(os.Stderr)
+		return exitUsage
+	}
+
+	name := args[0]
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage(os.Stdout)
+		return exitOK
+	}
+
+	cmd, ok := lookupCommand(name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "%s: unknown command %q\n\n", programName, name)
+		printUsage(os.Stderr)
+		return exitUsage
+	}
+
+	err = cmd.run(args[1:])
+	var usageErr usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(os.Stderr, "%s %s: %v\n", programName, cmd.name, err)
+		fmt.Fprintf(os.Stderr, "Usage: %s %s %s\n", programName, cmd.name, cmd.args)
+		return exitUsage
+	case isFlagError(err):
+		// The flag package has already printed the error and the usage.
+		return exitUsage
+	default:
+		fmt.Fprintf(os.Stderr, "%s %s: %v\n", programName, cmd.name, err)
+		return exitCode(err)
+	}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// flagError wraps errors returned by flag.FlagSet.Parse.
+type flagError struct {
+	err error
+}
+
+func (e flagError) Error() string { return e.err.Error() }
+func (e flagError) Unwrap() error { return e.err }
+
+func isFlagError(err error) bool {
+	var fe flagError
+	return errors.As(err, &fe)
+}
+
+func newFlagSet(name, args, summary string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	addGlobalFlags(fs)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage: %s %s [flags] %s\n\n%s\n", programName, name, args, summary)
+		var hasFlags bool
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintln(out, "\nFlags:")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+// parseArgs parses flags that may appear before, after or between positional
+// arguments and returns the positional arguments. Everything after "--" is
+// treated as positional.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, flagError{err}
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+func joinArgs(args []string) string {
+	return strings.TrimSpace(strings.Join(args, " "))
 }
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+// todoSchemaVersion is the current version of the todo list file format.
+//
+// History:
+//
+//	0: bare JSON array of todos, without IDs
+//	1: versioned envelope; every todo has an ID
+//	2: Completed and CompletedAt replaced by Status and Transitions
+const todoSchemaVersion = 2
+
+var todoMigrations = map[int]Migration{
+	0: migrateTodosV0,
+	1: migrateTodosV1,
+}
+
+func newTodoStorage(fileName string, opts ...StorageOption) *Storage[Todos] {
+	opts = append([]StorageOption{WithSchema(todoSchemaVersion, todoMigrations), WithKeyring(passphrases)}, opts...)
+	return NewStorage[Todos](fileName, opts...)
+}
+
+// historySchemaVersion is the current version of the undo history file
+// format. The history stores copies of todos, so it follows the todo
+// format changes.
+//
+// History:
+//
+//	0: bare JSON object, todos without statuses
+//	1: versioned envelope; todos have statuses
+const historySchemaVersion = 1
+
+var historyMigrations = map[int]Migration{
+	0: migrateHistoryV0,
+}
+
+func newHistoryStorage(fileName string, opts ...StorageOption) *Storage[History] {
+	opts = append([]StorageOption{WithSchema(historySchemaVersion, historyMigrations), WithKeyring(passphrases)}, opts...)
+	return NewStorage[History](fileName, opts...)
+}
+
+// archiveSchemaVersion is the current version of the archive file format.
+//
+// History:
+//
+//	1: versioned envelope of archived todos
+const archiveSchemaVersion = 1
+
+func newArchiveStorage(fileName string, opts ...StorageOption) *Storage[[]archivedTodo] {
+	opts = append([]StorageOption{WithSchema(archiveSchemaVersion, nil), WithKeyring(passphrases)}, opts...)
+	return NewStorage[[]archivedTodo](fileName, opts...)
+}
+
+// migrateTodosV0 gives every todo an ID. Migrations work on generic maps
+// rather than on Todo so they keep working as the struct evolves.
+func migrateTodosV0(data json.RawMessage) (json.RawMessage, error) {
+	var items []map[string]any
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+
+	used := map[string]bool{}
+	for _, item := range items {
+		if id, ok := item["ID"].(string); ok && id != "" {
+			used[id] = true
+		}
+	}
+	for _, item := range items {
+		if id, ok := item["ID"].(string); ok && id != "" {
+			continue
+		}
+		id := randomID(idLength)
+		for used[id] {
+			id = randomID(idLength)
+		}
+		used[id] = true
+		item["ID"] = id
+	}
+
+	if items == nil {
+		items = []map[string]any{}
+	}
+	return json.Marshal(items)
+}
+
+// migrateTodosV1 turns the Completed flag into a status. Completed todos
+// become done, with their creation and completion recorded as transitions;
+// all others become todo.
+func migrateTodosV1(data json.RawMessage) (json.RawMessage, error) {
+	var items []map[string]any
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		migrateTodoV1(item)
+	}
+
+	if items == nil {
+		items = []map[string]any{}
+	}
+	return json.Marshal(items)
+}
+
+func migrateTodoV1(item map[string]any) {
+	if item == nil {
+		return
+	}
+	transitions := []any{}
+	if created, ok := item["CreatedAt"]; ok {
+		transitions = append(transitions, map[string]any{"Status": StatusTodo, "At": created})
+	}
+	item["Status"] = StatusTodo
+	if completed, _ := item["Completed"].(bool); completed {
+		item["Status"] = StatusDone
+		if at, ok := item["CompletedAt"].(string); ok {
+			transitions = append(transitions, map[string]any{"Status": StatusDone, "At": at})
+		}
+	}
+	item["Transitions"] = transitions
+	delete(item, "Completed")
+	delete(item, "CompletedAt")
+}
+
+// migrateHistoryV0 applies migrateTodoV1 to the todos recorded in every
+// undo and redo step.
+func migrateHistoryV0(data json.RawMessage) (json.RawMessage, error) {
+	var history map[string]any
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, err
+	}
+	for _, stack := range []string{"Undo", "Redo"} {
+		ops, _ := history[stack].([]any)
+		for _, op := range ops {
+			op, _ := op.(map[string]any)
+			changes, _ := op["Changes"].([]any)
+			for _, c := range changes {
+				c, _ := c.(map[string]any)
+				for _, side := range []string{"Before", "After"} {
+					if todo, ok := c[side].(map[string]any); ok {
+						migrateTodoV1(todo)
+					}
+				}
+			}
+		}
+	}
+	return json.Marshal(history)
+}
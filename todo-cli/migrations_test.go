@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// upgradeFixture copies testdata/migrations/name.json to a temporary
+// directory and loads it into data, which upgrades it in place. It returns
+// the fixture and the upgraded file's path.
+func upgradeFixture[T any](t *testing.T, name string, newStorage func(string, ...StorageOption) *Storage[T], data *T) ([]byte, string) {
+	t.Helper()
+	fixture, err := os.ReadFile(filepath.Join("testdata", "migrations", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), name+".json")
+	if err := os.WriteFile(file, fixture, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := newStorage(file).Load(data); err != nil {
+		t.Fatal(err)
+	}
+	return fixture, file
+}
+
+// checkGolden compares got with testdata/migrations/name.golden.json, or
+// rewrites the golden file when the test runs with -update.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	golden := filepath.Join("testdata", "migrations", name+".golden.json")
+	if *update {
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("upgraded %s differs from %s:\n%s", name, golden, got)
+	}
+}
+
+// checkBackup checks that the file as it was before the upgrade was kept
+// next to it, and that loading the upgraded file again leaves it alone.
+func checkBackup(t *testing.T, file string, version int, fixture []byte, reload func() error) {
+	t.Helper()
+	backup := fmt.Sprintf("%s.v%d.bak", file, version)
+	got, err := os.ReadFile(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, fixture) {
+		t.Errorf("%s does not match the original file:\n%s", filepath.Base(backup), got)
+	}
+
+	upgraded, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reload(); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := os.ReadFile(file); !bytes.Equal(again, upgraded) {
+		t.Error("loading the upgraded file changed it again")
+	}
+	if matches, _ := filepath.Glob(file + ".v*.bak"); len(matches) != 1 {
+		t.Errorf("backups = %v, want only %s", matches, filepath.Base(backup))
+	}
+}
+
+func TestMigrateTodosV0(t *testing.T) {
+	var todos Todos
+	fixture, file := upgradeFixture(t, "todos_v0", newTodoStorage, &todos)
+
+	if len(todos) != 3 {
+		t.Fatalf("loaded %d todos, want 3", len(todos))
+	}
+	if todos[2].ID != "kept" {
+		t.Errorf("existing ID became %q", todos[2].ID)
+	}
+	if todos[0].ID == "" || todos[1].ID == "" || todos[0].ID == todos[1].ID {
+		t.Errorf("generated IDs %q and %q are not unique", todos[0].ID, todos[1].ID)
+	}
+	if todos[1].Status != StatusDone || todos[0].Status != StatusTodo {
+		t.Errorf("statuses = %s, %s; want todo, done", todos[0].Status, todos[1].Status)
+	}
+
+	// The generated IDs are random; give them fixed names before comparing.
+	got, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, todo := range todos[:2] {
+		pattern := regexp.MustCompile(`"ID": "` + regexp.QuoteMeta(todo.ID) + `"`)
+		got = pattern.ReplaceAll(got, []byte(fmt.Sprintf(`"ID": "new%d"`, i+1)))
+	}
+	checkGolden(t, "todos_v0", got)
+	checkBackup(t, file, 0, fixture, func() error {
+		var again Todos
+		return newTodoStorage(file).Load(&again)
+	})
+}
+
+func TestMigrateTodosV1(t *testing.T) {
+	var todos Todos
+	fixture, file := upgradeFixture(t, "todos_v1", newTodoStorage, &todos)
+
+	if len(todos) != 3 {
+		t.Fatalf("loaded %d todos, want 3", len(todos))
+	}
+	if todos[0].Status != StatusTodo || todos[0].Priority != PriorityHigh || todos[0].Due == nil {
+		t.Errorf("open todo lost fields: %+v", todos[0])
+	}
+	if todos[1].Status != StatusDone || len(todos[1].Transitions) != 2 {
+		t.Errorf("completed todo = %+v, want done with two transitions", todos[1])
+	}
+	if todos[2].Status != StatusDone || len(todos[2].Transitions) != 1 {
+		t.Errorf("completed todo without a time = %+v, want done with one transition", todos[2])
+	}
+
+	got, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "todos_v1", got)
+	checkBackup(t, file, 1, fixture, func() error {
+		var again Todos
+		return newTodoStorage(file).Load(&again)
+	})
+}
+
+func TestMigrateHistoryV0(t *testing.T) {
+	var history History
+	fixture, file := upgradeFixture(t, "history_v0", newHistoryStorage, &history)
+
+	if len(history.Undo) != 2 || len(history.Redo) != 1 {
+		t.Fatalf("loaded %d undo and %d redo steps, want 2 and 1", len(history.Undo), len(history.Redo))
+	}
+	toggled := history.Undo[1].Changes[0]
+	if toggled.Before.Status != StatusTodo || toggled.After.Status != StatusDone {
+		t.Errorf("toggle went from %s to %s, want todo to done", toggled.Before.Status, toggled.After.Status)
+	}
+
+	got, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "history_v0", got)
+	checkBackup(t, file, 0, fixture, func() error {
+		var again History
+		return newHistoryStorage(file).Load(&again)
+	})
+}
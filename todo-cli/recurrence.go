@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recurrence kinds.
+const (
+	RepeatDaily   = "daily"
+	RepeatWeekly  = "weekly"
+	RepeatMonthly = "monthly"
+	RepeatAfter   = "after"
+)
+
+// lastDay in Recurrence.Day means the last day of the month.
+const lastDay = -1
+
+// Recurrence describes when the next instance of a repeating todo is due.
+// Fixed schedules (daily, weekly, monthly) step from the previous due date;
+// "after" steps from the completion time.
+type Recurrence struct {
+	Kind string
+	// Interval is the number of days, weeks or months between instances.
+	Interval int `json:",omitempty"`
+	// Weekdays restricts weekly recurrences to the given days.
+	Weekdays []time.Weekday `json:",omitempty"`
+	// Day is the day of the month for monthly recurrences, or lastDay.
+	// Days past the end of a short month fall on its last day.
+	Day int `json:",omitempty"`
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseRecurrence parses a repeat specification:
+//
+//	daily, daily:N          every day, or every N days
+//	weekly, weekly:N        every week, or every N weeks, on the due weekday
+//	weekly:mon,thu          every week on the given weekdays
+//	monthly, monthly:N      every month on day N (or "last"); without N on
+//	                        the day of the due date
+//	after:N                 N days after the todo is completed
+//
+// The empty string and "none" mean no recurrence.
+func parseRecurrence(spec string) (*Recurrence, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	if spec == "" || spec == "none" {
+		return nil, nil
+	}
+	kind, arg, _ := strings.Cut(spec, ":")
+	r := &Recurrence{Kind: kind, Interval: 1}
+	invalid := fmt.Errorf("invalid repeat %q (want daily[:N], weekly[:N|:mon,...], monthly[:DAY|:last] or after:N)", spec)
+
+	positive := func(s string) (int, error) {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return 0, invalid
+		}
+		return n, nil
+	}
+
+	var err error
+	switch kind {
+	case RepeatDaily:
+		if arg != "" {
+			r.Interval, err = positive(arg)
+		}
+	case RepeatWeekly:
+		if arg == "" {
+			break
+		}
+		if _, nerr := strconv.Atoi(arg); nerr == nil {
+			r.Interval, err = positive(arg)
+			break
+		}
+		for _, name := range strings.Split(arg, ",") {
+			name = strings.TrimSpace(name)
+			if len(name) < 3 {
+				return nil, invalid
+			}
+			day, ok := weekdayNames[name[:3]]
+			if !ok {
+				return nil, invalid
+			}
+			if !slices.Contains(r.Weekdays, day) {
+				r.Weekdays = append(r.Weekdays, day)
+			}
+		}
+		slices.Sort(r.Weekdays)
+	case RepeatMonthly:
+		switch arg {
+		case "":
+		case "last":
+			r.Day = lastDay
+		default:
+			r.Day, err = positive(arg)
+			if err == nil && r.Day > 31 {
+				err = invalid
+			}
+		}
+	case RepeatAfter:
+		r.Interval, err = positive(arg)
+	default:
+		err = invalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r Recurrence) String() string {
+	switch r.Kind {
+	case RepeatDaily:
+		if r.Interval > 1 {
+			return fmt.Sprintf("daily:%d", r.Interval)
+		}
+	case RepeatWeekly:
+		if len(r.Weekdays) > 0 {
+			var names []string
+			for _, d := range r.Weekdays {
+				names = append(names, strings.ToLower(d.String()[:3]))
+			}
+			return "weekly:" + strings.Join(names, ",")
+		}
+		if r.Interval > 1 {
+			return fmt.Sprintf("weekly:%d", r.Interval)
+		}
+	case RepeatMonthly:
+		if r.Day == lastDay {
+			return "monthly:last"
+		}
+		if r.Day > 0 {
+			return fmt.Sprintf("monthly:%d", r.Day)
+		}
+	case RepeatAfter:
+		return fmt.Sprintf("after:%d", r.Interval)
+	}
+	return r.Kind
+}
+
+// anchor fills in the parts of r that default to the due date, so the
+// schedule stays put even after a clamped month end.
+func (r *Recurrence) anchor(due *time.Time) {
+	if r.Kind == RepeatMonthly && r.Day == 0 && due != nil {
+		r.Day = due.Day()
+	}
+}
+
+// next returns the due date of the instance following one that was due at
+// due (nil if it had no due date) and completed at done. Fixed schedules
+// skip occurrences that are already in the past at done, so completing an
+// overdue todo doesn't create another overdue one. Wall clock times are kept
+// across DST changes.
+func (r Recurrence) next(due *time.Time, done time.Time) time.Time {
+	interval := max(r.Interval, 1)
+
+	if r.Kind == RepeatAfter {
+		next := done.AddDate(0, 0, interval)
+		if due != nil {
+			d := due.In(done.Location())
+			y, m, day := next.Date()
+			next = time.Date(y, m, day, d.Hour(), d.Minute(), d.Second(), 0, done.Location())
+		}
+		return next
+	}
+
+	from := done
+	if due != nil {
+		from = *due
+	}
+	next := r.step(from)
+	for !next.After(done) {
+		next = r.step(next)
+	}
+	return next
+}
+
+// step returns the first occurrence of a fixed schedule strictly after from.
+func (r Recurrence) step(from time.Time) time.Time {
+	interval := max(r.Interval, 1)
+
+	switch r.Kind {
+	case RepeatWeekly:
+		if len(r.Weekdays) == 0 {
+			return from.AddDate(0, 0, 7*interval)
+		}
+		for i := 1; i <= 7; i++ {
+			next := from.AddDate(0, 0, i)
+			if slices.Contains(r.Weekdays, next.Weekday()) {
+				return next
+			}
+		}
+	case RepeatMonthly:
+		day := r.Day
+		if day == 0 {
+			day = from.Day()
+		}
+		if candidate := monthDay(from, 0, day); candidate.After(from) {
+			return candidate
+		}
+		return monthDay(from, interval, day)
+	}
+	return from.AddDate(0, 0, interval)
+}
+
+// monthDay returns day (or lastDay) of the month months after t's month,
+// clamped to that month's length, at t's time of day.
+func monthDay(t time.Time, months, day int) time.Time {
+	y, m, _ := t.Date()
+	first := time.Date(y, m+time.Month(months), 1, 0, 0, 0, 0, t.Location())
+	days := daysIn(first.Year(), first.Month())
+	if day == lastDay || day > days {
+		day = days
+	}
+	return time.Date(first.Year(), first.Month(), day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
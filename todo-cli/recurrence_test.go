@@ -0,0 +1,154 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecurrenceNext(t *testing.T) {
+	loc := newYork(t)
+	at := func(m time.Month, d, h int) time.Time {
+		return time.Date(2024, m, d, h, 0, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name string
+		spec string
+		due  time.Time
+		// want are the due dates of the following instances, each one
+		// completed on the day it is due.
+		want []time.Time
+	}{
+		{"monthly:31 through Feb and Apr", "monthly:31", at(1, 31, 9),
+			[]time.Time{at(2, 29, 9), at(3, 31, 9), at(4, 30, 9), at(5, 31, 9)}},
+		{"monthly anchored on the 31st", "monthly", at(1, 31, 9),
+			[]time.Time{at(2, 29, 9), at(3, 31, 9), at(4, 30, 9)}},
+		{"monthly:last", "monthly:last", at(1, 31, 9),
+			[]time.Time{at(2, 29, 9), at(3, 31, 9), at(4, 30, 9)}},
+		{"monthly:15 from before the 15th", "monthly:15", at(1, 10, 9),
+			[]time.Time{at(1, 15, 9), at(2, 15, 9)}},
+		{"monthly:2", "monthly:2", at(1, 31, 9),
+			[]time.Time{at(2, 2, 9), at(3, 2, 9)}},
+		{"weekly:mon,thu", "weekly:mon,thu", at(3, 4, 9),
+			[]time.Time{at(3, 7, 9), at(3, 11, 9), at(3, 14, 9)}},
+		{"weekly:2", "weekly:2", at(3, 4, 9),
+			[]time.Time{at(3, 18, 9), at(4, 1, 9)}},
+		{"daily:3", "daily:3", at(3, 4, 9),
+			[]time.Time{at(3, 7, 9), at(3, 10, 9)}},
+
+		// DST: the wall clock time is kept when clocks go forward on
+		// 10 March and back on 3 November.
+		{"daily across spring forward", "daily", at(3, 9, 9),
+			[]time.Time{at(3, 10, 9), at(3, 11, 9)}},
+		{"weekly across fall back", "weekly", at(10, 31, 9),
+			[]time.Time{at(11, 7, 9)}},
+		{"monthly across spring forward", "monthly:last", at(2, 29, 23),
+			[]time.Time{at(3, 31, 23)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := parseRecurrence(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			due := tt.due
+			r.anchor(&due)
+			for i, want := range tt.want {
+				got := r.next(&due, due)
+				if !got.Equal(want) {
+					t.Fatalf("instance %d after %v = %v, want %v", i+1, due, got, want)
+				}
+				due = got
+			}
+		})
+	}
+}
+
+func TestRecurrenceNextOverdue(t *testing.T) {
+	loc := newYork(t)
+	due := time.Date(2024, time.March, 1, 9, 0, 0, 0, loc)
+	done := time.Date(2024, time.March, 6, 10, 0, 0, 0, loc)
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		// Fixed schedules skip the occurrences already past at done.
+		{"daily", time.Date(2024, time.March, 7, 9, 0, 0, 0, loc)},
+		{"weekly", time.Date(2024, time.March, 8, 9, 0, 0, 0, loc)},
+		{"weekly:mon,thu", time.Date(2024, time.March, 7, 9, 0, 0, 0, loc)},
+		{"monthly", time.Date(2024, time.April, 1, 9, 0, 0, 0, loc)},
+		// after:N counts from done, at the due time of day.
+		{"after:3", time.Date(2024, time.March, 9, 9, 0, 0, 0, loc)},
+		// Across the spring DST change, still at 9:00.
+		{"after:5", time.Date(2024, time.March, 11, 9, 0, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		r, err := parseRecurrence(tt.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.anchor(&due)
+		if got := r.next(&due, done); !got.Equal(tt.want) {
+			t.Errorf("%s: next(%v, %v) = %v, want %v", tt.spec, due, done, got, tt.want)
+		}
+	}
+}
+
+func TestRecurrenceAfterWithoutDue(t *testing.T) {
+	loc := newYork(t)
+	done := time.Date(2024, time.March, 8, 14, 30, 0, 0, loc)
+	r := Recurrence{Kind: RepeatAfter, Interval: 2}
+	want := time.Date(2024, time.March, 10, 14, 30, 0, 0, loc)
+	if got := r.next(nil, done); !got.Equal(want) {
+		t.Errorf("next(nil, %v) = %v, want %v", done, got, want)
+	}
+}
+
+func TestRecurrenceStep(t *testing.T) {
+	loc := newYork(t)
+	tests := []struct {
+		r    Recurrence
+		from time.Time
+		want time.Time
+	}{
+		{Recurrence{Kind: RepeatMonthly, Interval: 1, Day: 31},
+			time.Date(2023, time.February, 28, 9, 0, 0, 0, loc),
+			time.Date(2023, time.March, 31, 9, 0, 0, 0, loc)},
+		{Recurrence{Kind: RepeatMonthly, Interval: 2, Day: 31},
+			time.Date(2024, time.February, 29, 9, 0, 0, 0, loc),
+			time.Date(2024, time.April, 30, 9, 0, 0, 0, loc)},
+		{Recurrence{Kind: RepeatMonthly, Interval: 1, Day: lastDay},
+			time.Date(2023, time.December, 31, 9, 0, 0, 0, loc),
+			time.Date(2024, time.January, 31, 9, 0, 0, 0, loc)},
+		{Recurrence{Kind: RepeatWeekly, Interval: 1, Weekdays: []time.Weekday{time.Monday, time.Thursday}},
+			time.Date(2024, time.March, 7, 9, 0, 0, 0, loc),
+			time.Date(2024, time.March, 11, 9, 0, 0, 0, loc)},
+		{Recurrence{Kind: RepeatDaily, Interval: 1},
+			time.Date(2024, time.November, 2, 9, 0, 0, 0, loc),
+			time.Date(2024, time.November, 3, 9, 0, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		if got := tt.r.step(tt.from); !got.Equal(tt.want) {
+			t.Errorf("%v.step(%v) = %v, want %v", tt.r, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestParseRecurrence(t *testing.T) {
+	for _, spec := range []string{"daily", "daily:2", "weekly:3", "weekly:mon,thu", "monthly", "monthly:31", "monthly:last", "after:4"} {
+		r, err := parseRecurrence(spec)
+		if err != nil {
+			t.Errorf("parseRecurrence(%q): %v", spec, err)
+			continue
+		}
+		if got := r.String(); got != spec {
+			t.Errorf("parseRecurrence(%q).String() = %q", spec, got)
+		}
+	}
+	for _, spec := range []string{"hourly", "daily:0", "weekly:fun", "monthly:32", "after", "after:-1"} {
+		if _, err := parseRecurrence(spec); err == nil {
+			t.Errorf("parseRecurrence(%q) succeeded, want an error", spec)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// outputFormats lists the values accepted by list --output.
+var outputFormats = []string{"table", "json", "jsonl", "csv", "tsv"}
+
+// namedTimeFormats are the shortcuts accepted by --time-format. Any other
+// value is used as a Go time layout.
+var namedTimeFormats = map[string]string{
+	"rfc1123": time.RFC1123,
+	"rfc3339": time.RFC3339,
+	"iso":     "2006-01-02 15:04",
+	"date":    "2006-01-02",
+	"kitchen": time.Kitchen,
+}
+
+const (
+	ansiRed   = "\033[31m"
+	ansiReset = "\033[0m"
+)
+
+// timeLayout returns the layout selected with --time-format, or def if none
+// was given.
+func (opts listOptions) timeLayout(def string) string {
+	if opts.TimeFormat == "" {
+		return def
+	}
+	if layout, ok := namedTimeFormats[strings.ToLower(opts.TimeFormat)]; ok {
+		return layout
+	}
+	return opts.TimeFormat
+}
+
+func (opts listOptions) colorize(color, s string) string {
+	if !opts.Color {
+		return s
+	}
+	return color + s + ansiReset
+}
+
+// render writes todos in one of the machine readable output formats.
+func render(w io.Writer, todos Todos, opts listOptions) error {
+	switch opts.Output {
+	case "json":
+		if todos == nil {
+			todos = Todos{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "    ")
+		return enc.Encode(todos)
+	case "jsonl":
+		enc := json.NewEncoder(w)
+		for _, t := range todos {
+			if err := enc.Encode(t); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(csvHeader)
+		for _, t := range todos {
+			cw.Write(plainRow(t, opts))
+		}
+		cw.Flush()
+		return cw.Error()
+	case "tsv":
+		// Fields are escaped in place, so the header is copied first.
+		rows := [][]string{slices.Clone(csvHeader)}
+		for _, t := range todos {
+			rows = append(rows, plainRow(t, opts))
+		}
+		for _, row := range rows {
+			for i, field := range row {
+				row[i] = tsvEscaper.Replace(field)
+			}
+			if _, err := fmt.Fprintln(w, strings.Join(row, "\t")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q", opts.Output)
+}
+
+// tsvEscaper keeps every todo on one line with a fixed number of fields.
+var tsvEscaper = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+
+// plainRow renders t with the columns of csvHeader, formatting times with
+// the configured layout (RFC3339 by default).
+func plainRow(t Todo, opts listOptions) []string {
+	layout := opts.timeLayout(time.RFC3339)
+	format := func(tp *time.Time) string {
+		if tp == nil {
+			return ""
+		}
+		return local(*tp).Format(layout)
+	}
+
+	return []string{
+		t.ID,
+		t.Title,
+		string(t.status()),
+		strconv.FormatBool(t.isDone()),
+		local(t.CreatedAt).Format(layout),
+		format(t.completedAt()),
+		format(t.Due),
+		string(t.Priority),
+		strings.Join(t.Tags, " "),
+		recurrenceString(t.Recur),
+		t.ParentID,
+		strings.Join(t.BlockedBy, " "),
+	}
+}
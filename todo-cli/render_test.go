@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRenderTSVLeavesHeaderAlone(t *testing.T) {
+	old := csvHeader
+	t.Cleanup(func() { csvHeader = old })
+	csvHeader = append(slices.Clone(old), "Blocked\tBy")
+	header := slices.Clone(csvHeader)
+
+	var out bytes.Buffer
+	todos := Todos{{ID: "a2b3", Title: "tab\there", Status: StatusTodo}}
+	if err := render(&out, todos, listOptions{Output: "tsv"}); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(csvHeader, header) {
+		t.Errorf("rendering changed csvHeader to %q", csvHeader)
+	}
+	first, _, _ := strings.Cut(out.String(), "\n")
+	if !strings.HasSuffix(first, "\tBlocked By") {
+		t.Errorf("header line = %q, want the field escaped", first)
+	}
+}
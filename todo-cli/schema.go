@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Migration upgrades a serialized payload by one schema version.
+type Migration func(data json.RawMessage) (json.RawMessage, error)
+
+// envelope is the on-disk form of a versioned Storage value.
+type envelope struct {
+	Version int             `json:"version"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// schema describes the current version of a stored value and how to reach
+// it from older ones. The zero schema stores values without an envelope.
+type schema struct {
+	version    int
+	migrations map[int]Migration
+}
+
+func (s schema) marshal(data any) ([]byte, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return s.wrap(payload)
+}
+
+// wrap puts payload in an envelope for the current version and indents it.
+func (s schema) wrap(payload json.RawMessage) ([]byte, error) {
+	var v any = payload
+	if s.version > 0 {
+		v = envelope{Version: s.version, Data: payload}
+	}
+	return json.MarshalIndent(v, "", "    ")
+}
+
+// unwrap returns the payload and version of fileData. Anything that is not
+// an envelope is treated as a version 0 payload.
+func unwrap(fileData []byte) (json.RawMessage, int) {
+	trimmed := bytes.TrimSpace(fileData)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var probe struct {
+			Version *int            `json:"version"`
+			Data    json.RawMessage `json:"data"`
+		}
+		if json.Unmarshal(trimmed, &probe) == nil && probe.Version != nil && probe.Data != nil {
+			return probe.Data, *probe.Version
+		}
+	}
+	return trimmed, 0
+}
+
+// upgrade runs the migrations needed to bring fileData to the current
+// version. It returns the upgraded payload and the version fileData had.
+func (s schema) upgrade(fileData []byte) (json.RawMessage, int, error) {
+	payload, version := unwrap(fileData)
+	if version > s.version {
+		return nil, version, fmt.Errorf("%w: data has version %d, newest supported is %d", ErrUnsupportedVersion, version, s.version)
+	}
+
+	for v := version; v < s.version; v++ {
+		migrate, ok := s.migrations[v]
+		if !ok {
+			return nil, version, fmt.Errorf("no migration from schema version %d to %d", v, v+1)
+		}
+		var err error
+		if payload, err = migrate(payload); err != nil {
+			return nil, version, fmt.Errorf("%w: migrating schema version %d to %d: %v", ErrCorrupt, v, v+1, err)
+		}
+	}
+	return payload, version, nil
+}
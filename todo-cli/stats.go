@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// burndownWidth is the length of the longest bar in the burndown chart.
+const burndownWidth = 50
+
+// stats summarizes the todos of a list over a date range. Deleted todos
+// are gone from the list, so they are not counted.
+type stats struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+
+	// Created counts the todos created in the range, and Done and
+	// Cancelled how many of those are now done or cancelled.
+	Created   int `json:"created"`
+	Done      int `json:"done"`
+	Cancelled int `json:"cancelled"`
+	// CompletionRate is Done divided by the created todos that weren't
+	// cancelled.
+	CompletionRate float64 `json:"completion_rate"`
+
+	// AverageLeadTime is the mean time from creation to completion of the
+	// todos completed in the range.
+	AverageLeadTime time.Duration `json:"average_lead_time_seconds"`
+
+	Weeks    []weekStats `json:"weeks"`
+	Burndown []dayOpen   `json:"burndown"`
+}
+
+// weekStats counts the todos created and completed in the week starting on
+// Monday Start.
+type weekStats struct {
+	Start     string `json:"start"`
+	Created   int    `json:"created"`
+	Completed int    `json:"completed"`
+}
+
+// dayOpen is the number of open todos at the end of a day.
+type dayOpen struct {
+	Day  string `json:"day"`
+	Open int    `json:"open"`
+}
+
+func (s stats) MarshalJSON() ([]byte, error) {
+	type plain stats
+	p := plain(s)
+	p.AverageLeadTime /= time.Second
+	return json.Marshal(p)
+}
+
+// statusAt returns the status the todo had at time at, or "" if it didn't
+// exist yet.
+func (t Todo) statusAt(at time.Time) Status {
+	if t.CreatedAt.After(at) {
+		return ""
+	}
+	status := StatusTodo
+	if len(t.Transitions) == 0 {
+		status = t.status()
+	}
+	for _, tr := range t.Transitions {
+		if tr.At.After(at) {
+			break
+		}
+		status = tr.Status
+	}
+	return status
+}
+
+// weekStart returns the Monday starting the week of t.
+func weekStart(t time.Time) time.Time {
+	y, m, d := t.Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
+
+// newStats computes the statistics for the days from the start of from to
+// the end of to.
+func newStats(todos Todos, from, to time.Time) stats {
+	end := to.AddDate(0, 0, 1)
+	s := stats{From: from, To: to}
+	inRange := func(t *time.Time) bool {
+		return t != nil && !t.Before(from) && t.Before(end)
+	}
+
+	weeks := map[string]*weekStats{}
+	for w := weekStart(from); w.Before(end); w = w.AddDate(0, 0, 7) {
+		ws := &weekStats{Start: w.Format(dayFormat)}
+		weeks[ws.Start] = ws
+		s.Weeks = append(s.Weeks, *ws)
+	}
+
+	// Todos may carry the offset of another zone, say from a synced file,
+	// so their weeks are worked out in the zone of the range.
+	week := func(t time.Time) *weekStats {
+		return weeks[weekStart(t.In(from.Location())).Format(dayFormat)]
+	}
+
+	var lead time.Duration
+	var completed int
+	for _, t := range todos {
+		if inRange(&t.CreatedAt) {
+			s.Created++
+			switch t.status() {
+			case StatusDone:
+				s.Done++
+			case StatusCancelled:
+				s.Cancelled++
+			}
+			if ws := week(t.CreatedAt); ws != nil {
+				ws.Created++
+			}
+		}
+		if at := t.completedAt(); inRange(at) {
+			completed++
+			lead += at.Sub(t.CreatedAt)
+			if ws := week(*at); ws != nil {
+				ws.Completed++
+			}
+		}
+	}
+	if n := s.Created - s.Cancelled; n > 0 {
+		s.CompletionRate = float64(s.Done) / float64(n)
+	}
+	if completed > 0 {
+		s.AverageLeadTime = lead / time.Duration(completed)
+	}
+	for i := range s.Weeks {
+		s.Weeks[i] = *weeks[s.Weeks[i].Start]
+	}
+
+	for day := from; day.Before(end); day = day.AddDate(0, 0, 1) {
+		dayEnd := day.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		open := 0
+		for _, t := range todos {
+			if st := t.statusAt(dayEnd); st != "" && !st.closed() {
+				open++
+			}
+		}
+		s.Burndown = append(s.Burndown, dayOpen{Day: day.Format(dayFormat), Open: open})
+	}
+	return s
+}
+
+// print writes the statistics as text with an ASCII burndown chart.
+func (s stats) print(w io.Writer) {
+	fmt.Fprintf(w, "From %s to %s\n\n", s.From.Format(dayFormat), s.To.Format(dayFormat))
+	fmt.Fprintf(w, "Created:           %d\n", s.Created)
+	fmt.Fprintf(w, "Done:              %d\n", s.Done)
+	fmt.Fprintf(w, "Cancelled:         %d\n", s.Cancelled)
+	fmt.Fprintf(w, "Completion rate:   %.0f%%\n", s.CompletionRate*100)
+	fmt.Fprintf(w, "Average lead time: %s\n", formatLeadTime(s.AverageLeadTime))
+
+	fmt.Fprintf(w, "\nWeek of      Created  Completed\n")
+	for _, ws := range s.Weeks {
+		fmt.Fprintf(w, "%-10s  %8d  %9d\n", ws.Start, ws.Created, ws.Completed)
+	}
+
+	fmt.Fprintf(w, "\nBurndown (open todos at the end of each day)\n")
+	most := 0
+	for _, d := range s.Burndown {
+		most = max(most, d.Open)
+	}
+	for _, d := range s.Burndown {
+		bar := 0
+		if most > 0 {
+			bar = (d.Open*burndownWidth + most - 1) / most
+		}
+		fmt.Fprintf(w, "%s |%-*s %d\n", d.Day, burndownWidth, strings.Repeat("#", bar), d.Open)
+	}
+}
+
+// formatLeadTime prints d in days and hours, e.g. "3d 4h".
+func formatLeadTime(d time.Duration) string {
+	d = d.Round(time.Hour)
+	days := int(d.Hours()) / 24
+	if days == 0 {
+		return formatDuration(d)
+	}
+	return fmt.Sprintf("%dd %dh", days, int(d.Hours())%24)
+}
+
+func cmdStats() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("stats", "", "Show completion statistics and a burndown chart.")
+	from := fs.String("from", "", "first day to include (default: four weeks ago)")
+	to := fs.String("to", "", "last day to include (default: today)")
+	output := fs.String("output", "text", "output format: text or json")
+	return fs, func(rest []string) error {
+		var err error
+		if len(rest) > 0 {
+			return usagef("unexpected arguments: %v", rest)
+		}
+		if !slices.Contains([]string{"text", "json"}, *output) {
+			return usagef("invalid output format %q (want text or json)", *output)
+		}
+
+		y, m, d := local(clock()).Date()
+		end := time.Date(y, m, d, 0, 0, 0, 0, zone())
+		if *to != "" {
+			if end, err = parseDay(*to); err != nil {
+				return usagef("--to: %v", err)
+			}
+		}
+		start := end.AddDate(0, 0, -27)
+		if *from != "" {
+			if start, err = parseDay(*from); err != nil {
+				return usagef("--from: %v", err)
+			}
+		}
+		if end.Before(start) {
+			return usagef("--from must not be after --to")
+		}
+
+		return withTodos("", func(todos *Todos) error {
+			s := newStats(*todos, start, end)
+			if *output == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "    ")
+				return enc.Encode(s)
+			}
+			s.print(os.Stdout)
+			return nil
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewStatsOtherZone(t *testing.T) {
+	// The todo was created on Monday 10 March at 01:30 in +02:00, which is
+	// still Sunday 9 March in UTC, the last day of the range.
+	created := time.Date(2025, 3, 10, 1, 30, 0, 0, time.FixedZone("", 2*60*60))
+	done := created.Add(15 * time.Minute)
+	todos := Todos{{
+		ID:          "aaaa",
+		Title:       "synced",
+		Status:      StatusDone,
+		CreatedAt:   created,
+		Transitions: []Transition{{StatusTodo, created}, {StatusDone, done}},
+	}}
+	from := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 3, 9, 0, 0, 0, 0, time.UTC)
+
+	s := newStats(todos, from, to)
+
+	if s.Created != 1 || s.Done != 1 {
+		t.Errorf("created %d, done %d; want 1 and 1", s.Created, s.Done)
+	}
+	if len(s.Weeks) != 1 {
+		t.Fatalf("got %d weeks, want 1", len(s.Weeks))
+	}
+	if w := s.Weeks[0]; w.Start != "2025-03-03" || w.Created != 1 || w.Completed != 1 {
+		t.Errorf("week = %+v, want 2025-03-03 with 1 created and 1 completed", w)
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aquasecurity/table"
+)
+
+// Status is the workflow state of a todo.
+type Status string
+
+const (
+	StatusTodo       Status = "todo"
+	StatusInProgress Status = "in-progress"
+	StatusBlocked    Status = "blocked"
+	StatusDone       Status = "done"
+	StatusCancelled  Status = "cancelled"
+)
+
+// statuses lists every status in workflow order.
+var statuses = []Status{StatusTodo, StatusInProgress, StatusBlocked, StatusDone, StatusCancelled}
+
+// ErrTransition is returned when the workflow doesn't allow a status change.
+var ErrTransition = errors.New("status change not allowed")
+
+func parseStatus(s string) (Status, error) {
+	st := Status(strings.ToLower(strings.TrimSpace(s)))
+	if st == "in_progress" || st == "inprogress" || st == "doing" {
+		st = StatusInProgress
+	}
+	if !slices.Contains(statuses, st) {
+		var names []string
+		for _, s := range statuses {
+			names = append(names, string(s))
+		}
+		return "", fmt.Errorf("invalid status %q (want %s)", s, strings.Join(names, ", "))
+	}
+	return st, nil
+}
+
+// closed reports whether a todo in this status needs no more work.
+func (s Status) closed() bool {
+	return s == StatusDone || s == StatusCancelled
+}
+
+// Transition records when a todo entered a status.
+type Transition struct {
+	Status Status
+	At     time.Time
+}
+
+// workflow maps each status to the statuses it may change to.
+type workflow map[Status][]Status
+
+var defaultWorkflow = workflow{
+	StatusTodo:       {StatusInProgress, StatusBlocked, StatusDone, StatusCancelled},
+	StatusInProgress: {StatusTodo, StatusBlocked, StatusDone, StatusCancelled},
+	StatusBlocked:    {StatusTodo, StatusInProgress, StatusCancelled},
+	StatusDone:       {StatusTodo},
+	StatusCancelled:  {StatusTodo},
+}
+
+func (w workflow) allows(from, to Status) bool {
+	return from == to || slices.Contains(w[from], to)
+}
+
+// validate checks that a workflow only mentions known statuses.
+func (w workflow) validate() error {
+	for from, targets := range w {
+		if _, err := parseStatus(string(from)); err != nil {
+			return err
+		}
+		for _, to := range targets {
+			if _, err := parseStatus(string(to)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// status returns the todo's status; todos created without one are todo.
+func (t Todo) status() Status {
+	if t.Status == "" {
+		return StatusTodo
+	}
+	return t.Status
+}
+
+func (t Todo) isDone() bool {
+	return t.status() == StatusDone
+}
+
+func (t Todo) isClosed() bool {
+	return t.status().closed()
+}
+
+// enteredAt returns when the todo last entered its current status, or nil
+// if that was never recorded.
+func (t Todo) enteredAt() *time.Time {
+	for i := len(t.Transitions) - 1; i >= 0; i-- {
+		if t.Transitions[i].Status == t.status() {
+			at := t.Transitions[i].At
+			return &at
+		}
+	}
+	return nil
+}
+
+// completedAt returns when a done todo was completed, or nil.
+func (t Todo) completedAt() *time.Time {
+	if !t.isDone() {
+		return nil
+	}
+	return t.enteredAt()
+}
+
+// changeStatus moves the todo at index to status if the workflow allows it.
+func (todos *Todos) changeStatus(index int, to Status) error {
+	from := (*todos)[index].status()
+	if from == to {
+		return nil
+	}
+	if !global.config.Workflow.allows(from, to) {
+		return fmt.Errorf("%w: %s → %s", ErrTransition, from, to)
+	}
+	todos.setStatus(index, to)
+	return nil
+}
+
+// setStatus moves the todo at index to status and records the transition.
+// Closing a todo stops its timer, and completing a recurring todo spawns its
+// next instance.
+func (todos *Todos) setStatus(index int, to Status) {
+	t := &(*todos)[index]
+	now := clock()
+	t.Status = to
+	t.Transitions = append(t.Transitions, Transition{Status: to, At: now})
+	if to.closed() && t.running() {
+		t.Sessions[len(t.Sessions)-1].End = &now
+	}
+
+	if to == StatusDone && t.Recur != nil {
+		todos.spawnNext(index)
+	}
+}
+
+// statusMarker is the short symbol shown for a status in tables.
+func statusMarker(s Status, ascii bool) string {
+	if ascii {
+		switch s {
+		case StatusDone:
+			return "[x]"
+		case StatusInProgress:
+			return "[~]"
+		case StatusBlocked:
+			return "[!]"
+		case StatusCancelled:
+			return "[-]"
+		}
+		return "[ ]"
+	}
+	switch s {
+	case StatusDone:
+		return "✅"
+	case StatusInProgress:
+		return "⏳"
+	case StatusBlocked:
+		return "⛔"
+	case StatusCancelled:
+		return "🚫"
+	}
+	return "❎"
+}
+
+// printKanban prints rows as a board with one column per status, keeping
+// their order within each column.
+func printKanban(w io.Writer, rows Todos, opts listOptions) error {
+	columns := map[Status][]string{}
+	height := 0
+	for _, t := range rows {
+		card := t.ID + " " + t.Title
+		if t.Due != nil {
+			card += " (due " + local(*t.Due).Format(opts.timeLayout(dueFormat)) + ")"
+			if t.isOverdue(clock()) {
+				card = opts.colorize(ansiRed, card)
+			}
+		}
+		s := t.status()
+		columns[s] = append(columns[s], card)
+		height = max(height, len(columns[s]))
+	}
+
+	shown := statuses
+	if opts.Status != "" {
+		shown = []Status{opts.Status}
+	}
+
+	tbl := table.New(w)
+	if opts.ASCII {
+		tbl.SetDividers(table.ASCIIDividers)
+	}
+	tbl.SetRowLines(false)
+	var headers []string
+	for _, s := range shown {
+		headers = append(headers, fmt.Sprintf("%s %s (%d)", statusMarker(s, opts.ASCII), s, len(columns[s])))
+	}
+	tbl.SetHeaders(headers...)
+	for i := 0; i < height; i++ {
+		var row []string
+		for _, s := range shown {
+			cell := ""
+			if i < len(columns[s]) {
+				cell = columns[s][i]
+			}
+			row = append(row, cell)
+		}
+		tbl.AddRow(row...)
+	}
+	tbl.Render()
+	return nil
+}
@@ -2,36 +2,252 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
 )
 
 
 type Storage[T any] struct{
 	FileName string
+	backend Backend
+	schema schema
+	keys *Keyring
+	// encrypt is set when Save encrypts, either because it was asked to
+	// or because Load found encrypted data.
+	encrypt bool
 }
 
-func NewStorage[T any](fileName string) *Storage[T]{
-	return &Storage[T]{FileName: fileName}
+// StorageOption configures a Storage created by NewStorage.
+type StorageOption func(o *storageOptions)
+
+type storageOptions struct {
+	fileName string
+	backend  Backend
+	schema   schema
+	keys     *Keyring
+	encrypt  bool
+}
+
+// WithJSONFile stores the value as an indented JSON file. This is the default.
+func WithJSONFile() StorageOption {
+	return func(o *storageOptions) {
+		o.backend = NewJSONFileBackend(o.fileName)
+	}
+}
+
+// WithJournal stores the value in an append-only JSON-lines journal.
+func WithJournal() StorageOption {
+	return func(o *storageOptions) {
+		o.backend = NewJournalBackend(o.fileName)
+	}
+}
+
+// WithMemory keeps the value in memory only.
+func WithMemory() StorageOption {
+	return func(o *storageOptions) {
+		o.backend = NewMemoryBackend()
+	}
+}
+
+// WithSchema makes Save write the value inside a versioned envelope and Load
+// upgrade older payloads. migrations[n] upgrades a payload from version n to
+// n+1; payloads written without an envelope are version 0.
+func WithSchema(version int, migrations map[int]Migration) StorageOption {
+	return func(o *storageOptions) {
+		o.schema = schema{version: version, migrations: migrations}
+	}
+}
+
+// WithKeyring lets Load read encrypted data with keys from k. Data loaded
+// encrypted is saved encrypted again; plain data stays plain.
+func WithKeyring(k *Keyring) StorageOption {
+	return func(o *storageOptions) {
+		o.keys = k
+	}
+}
+
+// WithEncryption makes Save always encrypt, with keys from k.
+func WithEncryption(k *Keyring) StorageOption {
+	return func(o *storageOptions) {
+		o.keys = k
+		o.encrypt = true
+	}
+}
+
+// WithBackend uses a caller provided backend.
+func WithBackend(b Backend) StorageOption {
+	return func(o *storageOptions) {
+		o.backend = b
+	}
+}
+
+func NewStorage[T any](fileName string, opts ...StorageOption) *Storage[T]{
+	o := storageOptions{fileName: fileName}
+	WithJSONFile()(&o)
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Storage[T]{FileName: fileName, backend: o.backend, schema: o.schema, keys: o.keys, encrypt: o.encrypt}
 }
 
 
 func (s *Storage[T]) Save(data T) error{
-	fileData, err := json.MarshalIndent(data, "","    ")
+	fileData, err := s.schema.marshal(data)
 
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(s.FileName, fileData, 0644)
+	return s.write(fileData)
+}
+
+// write hands fileData to the backend, encrypting it if needed.
+func (s *Storage[T]) write(fileData []byte) error{
+	if s.encrypt {
+		sealed, err := s.keys.seal(fileData)
+		if err != nil {
+			return fmt.Errorf("encrypting %s: %w", s.FileName, err)
+		}
+		fileData = sealed
+	}
+	return s.backend.Write(fileData)
+}
+
+// Encrypted reports whether Save encrypts the data.
+func (s *Storage[T]) Encrypted() bool{
+	return s.encrypt
 }
 
 
 func (s *Storage[T]) Load (data *T) error {
-	fileData, err := os.ReadFile(s.FileName)
+	return s.load(data, true)
+}
+
+// Peek is Load for readers: older data is upgraded in memory only, so the
+// stored data and its backups are left as they are. Callers may hold RLock
+// instead of Lock.
+func (s *Storage[T]) Peek(data *T) error {
+	return s.load(data, false)
+}
+
+// load reads data, upgrading it from older schema versions. With writeBack
+// the upgraded form replaces the stored one.
+func (s *Storage[T]) load(data *T, writeBack bool) error {
+	fileData, err := s.backend.Read()
 
 	if err != nil {
-		return nil
+		// A missing file just means nothing was saved yet.
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("reading %s: %w", s.FileName, err)
 	}
+	stored := fileData
 
-	return json.Unmarshal(fileData, data)
+	if isSealed(fileData) {
+		if s.keys == nil {
+			return fmt.Errorf("%s: %w", s.FileName, ErrNoPassphrase)
+		}
+		if fileData, err = s.keys.open(fileData); err != nil {
+			return fmt.Errorf("%s: %w", s.FileName, err)
+		}
+		s.encrypt = true
+	}
+
+	payload, version, err := s.schema.upgrade(fileData)
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.FileName, err)
+	}
+	if version != s.schema.version && writeBack {
+		// Keep the file as it was before the migration and write the
+		// upgraded form back, so later loads skip the migration. Callers
+		// are expected to hold Lock.
+		if b, ok := s.backend.(backupper); ok {
+			if err := b.Backup(fmt.Sprintf(".v%d.bak", version), stored); err != nil {
+				return fmt.Errorf("backing up version %d data: %w", version, err)
+			}
+		}
+		upgraded, err := s.schema.wrap(payload)
+		if err != nil {
+			return err
+		}
+		if err := s.write(upgraded); err != nil {
+			return err
+		}
+	}
+
+	if err := json.Unmarshal(payload, data); err != nil {
+		return fmt.Errorf("%s: %w: %v", s.FileName, ErrCorrupt, err)
+	}
+	return nil
+}
+
+// Lock takes an exclusive advisory lock on the storage. Hold it across Load,
+// the mutation and Save so that concurrent processes serialize instead of
+// overwriting each other's changes. The returned function releases it.
+// Backends without cross-process locking get a no-op lock.
+func (s *Storage[T]) Lock() (unlock func() error, err error) {
+	return s.lock(true)
+}
+
+// RLock takes a shared advisory lock on the storage, for readers that must
+// not observe a write in progress. Load may write, so readers holding only
+// RLock use Peek.
+func (s *Storage[T]) RLock() (unlock func() error, err error) {
+	return s.lock(false)
+}
+
+func (s *Storage[T]) lock(exclusive bool) (func() error, error) {
+	if l, ok := s.backend.(fileLocker); ok {
+		return l.Lock(exclusive)
+	}
+	return func() error { return nil }, nil
+}
+
+// writeFileAtomic writes data to a temporary file next to fileName, syncs it
+// and renames it over fileName, so readers and crashes never see a partially
+// written file. A new file gets perm; an existing one keeps its mode.
+func writeFileAtomic(fileName string, data []byte, perm os.FileMode) (err error) {
+	dir := filepath.Dir(fileName)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(fileName)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		return err
+	}
+	// Replacing a file keeps its mode, so lists made private stay so.
+	if info, serr := os.Stat(fileName); serr == nil {
+		perm = info.Mode().Perm()
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), fileName); err != nil {
+		return err
+	}
+
+	// Sync the directory so the rename itself survives a crash. Not every
+	// platform supports this, so failures are ignored.
+	if d, derr := os.Open(dir); derr == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
 }
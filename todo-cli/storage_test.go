@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestSaveKeepsFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on Windows")
+	}
+	file := filepath.Join(t.TempDir(), "todos.json")
+	writeTodos(t, file, Todos{{ID: "a2b3", Title: "private", Status: StatusTodo}}, false)
+	if info, err := os.Stat(file); err != nil || info.Mode().Perm() != 0644 {
+		t.Fatalf("new file mode = %v, %v; want 0644", info.Mode().Perm(), err)
+	}
+
+	if err := os.Chmod(file, 0600); err != nil {
+		t.Fatal(err)
+	}
+	writeTodos(t, file, Todos{{ID: "a2b3", Title: "still private", Status: StatusTodo}}, false)
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("mode after saving = %v, want 0600", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"time"
+)
+
+// ErrMergeConflict is returned by merge --strict when both sides changed the
+// same field of a todo.
+var ErrMergeConflict = errors.New("merge conflicts")
+
+// syncFields are the groups of Todo fields that are merged and time stamped
+// together, keyed by the name used in Todo.Modified. A status and the
+// transitions leading to it only make sense together.
+var syncFields = []struct {
+	name   string
+	fields []string
+}{
+	{"Title", []string{"Title"}},
+	{"Status", []string{"Status", "Transitions"}},
+	{"Due", []string{"Due"}},
+	{"Priority", []string{"Priority"}},
+	{"Tags", []string{"Tags"}},
+	{"Recur", []string{"Recur"}},
+	{"ParentID", []string{"ParentID"}},
+	{"BlockedBy", []string{"BlockedBy"}},
+	{"Sessions", []string{"Sessions"}},
+}
+
+// todoFields returns the JSON encoding of each field of t. Fields left out
+// because they are empty are missing from the map.
+func todoFields(t Todo) map[string]json.RawMessage {
+	data, err := json.Marshal(t)
+	if err != nil {
+		panic(err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		panic(err)
+	}
+	return fields
+}
+
+// sameFields reports whether a and b agree on all the named fields.
+func sameFields(a, b map[string]json.RawMessage, names []string) bool {
+	for _, name := range names {
+		if !bytes.Equal(a[name], b[name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// modifiedAt returns when the field group was last changed. Fields that
+// were never changed date from the todo's creation.
+func (t Todo) modifiedAt(group string) time.Time {
+	if at, ok := t.Modified[group]; ok {
+		return at
+	}
+	return t.CreatedAt
+}
+
+// stamp records now as the modification time of every field group that
+// differs from before. Todos that didn't exist before keep no stamps; their
+// creation time stands in for them.
+func (todos *Todos) stamp(before Todos, now time.Time) {
+	old := map[string]Todo{}
+	for _, t := range before {
+		old[t.ID] = t
+	}
+	for i := range *todos {
+		t := &(*todos)[i]
+		prev, ok := old[t.ID]
+		if !ok {
+			continue
+		}
+		a, b := todoFields(prev), todoFields(*t)
+		stamped := false
+		for _, g := range syncFields {
+			if !sameFields(a, b, g.fields) {
+				// The map may be shared with a copy kept in the
+				// undo history, so it is replaced, not changed.
+				if !stamped {
+					t.Modified = maps.Clone(t.Modified)
+					if t.Modified == nil {
+						t.Modified = map[string]time.Time{}
+					}
+					stamped = true
+				}
+				t.Modified[g.name] = now
+			}
+		}
+	}
+}
+
+// mergeConflict is a field both sides changed to different values.
+type mergeConflict struct {
+	ID     string
+	Field  string
+	Winner string
+}
+
+// mergeResult summarizes a three-way merge.
+type mergeResult struct {
+	Todos     Todos
+	Added     int
+	Deleted   int
+	Updated   int
+	Conflicts []mergeConflict
+}
+
+// mergeTodos merges the changes made to base in local and remote, matching
+// todos by ID. When both sides changed the same field the one changed last
+// wins, with ties going to local, and the conflict is reported. A todo
+// deleted on one side and changed on the other is kept.
+func mergeTodos(base, local, remote Todos) mergeResult {
+	index := func(todos Todos) map[string]Todo {
+		m := map[string]Todo{}
+		for _, t := range todos {
+			m[t.ID] = t
+		}
+		return m
+	}
+	baseByID, localByID, remoteByID := index(base), index(local), index(remote)
+
+	var r mergeResult
+	resolve := func(id string) (Todo, bool) {
+		b, inBase := baseByID[id]
+		l, inLocal := localByID[id]
+		rt, inRemote := remoteByID[id]
+		switch {
+		case inLocal && !inRemote:
+			if !inBase {
+				return l, true
+			}
+			if sameTodo(l, b) {
+				r.Deleted++
+				return Todo{}, false
+			}
+			r.Conflicts = append(r.Conflicts, mergeConflict{ID: id, Field: "deleted", Winner: "local"})
+			return l, true
+		case inRemote && !inLocal:
+			if !inBase {
+				r.Added++
+				return rt, true
+			}
+			if sameTodo(rt, b) {
+				return Todo{}, false
+			}
+			r.Conflicts = append(r.Conflicts, mergeConflict{ID: id, Field: "deleted", Winner: "remote"})
+			r.Added++
+			return rt, true
+		case !inLocal && !inRemote:
+			return Todo{}, false
+		}
+
+		// Todos added on both sides with the same ID merge against an
+		// empty base, so every difference is a conflict.
+		if !inBase {
+			b = Todo{ID: id}
+		}
+		bf, lf, rf := todoFields(b), todoFields(l), todoFields(rt)
+		merged := todoFields(l)
+		modified := map[string]time.Time{}
+		changed := false
+		for _, g := range syncFields {
+			take := "local"
+			switch {
+			case sameFields(lf, rf, g.fields):
+			case sameFields(lf, bf, g.fields):
+				take = "remote"
+			case sameFields(rf, bf, g.fields):
+			default:
+				if rt.modifiedAt(g.name).After(l.modifiedAt(g.name)) {
+					take = "remote"
+				}
+				r.Conflicts = append(r.Conflicts, mergeConflict{ID: id, Field: g.name, Winner: take})
+			}
+
+			from, at := lf, l.Modified[g.name]
+			if take == "remote" {
+				from, at = rf, rt.Modified[g.name]
+				changed = true
+			}
+			for _, name := range g.fields {
+				if v, ok := from[name]; ok {
+					merged[name] = v
+				} else {
+					delete(merged, name)
+				}
+			}
+			if !at.IsZero() {
+				modified[g.name] = at
+			}
+		}
+
+		var t Todo
+		data, _ := json.Marshal(merged)
+		if err := json.Unmarshal(data, &t); err != nil {
+			panic(err)
+		}
+		t.Modified = nil
+		if len(modified) > 0 {
+			t.Modified = modified
+		}
+		if changed {
+			r.Updated++
+		}
+		return t, true
+	}
+
+	// Local order is kept; todos only the remote side has go last, in the
+	// remote order.
+	for _, t := range local {
+		if merged, ok := resolve(t.ID); ok {
+			r.Todos = append(r.Todos, merged)
+		}
+	}
+	for _, t := range remote {
+		if _, ok := localByID[t.ID]; ok {
+			continue
+		}
+		if merged, ok := resolve(t.ID); ok {
+			r.Todos = append(r.Todos, merged)
+		}
+	}
+	return r
+}
+
+// readTodosFile loads the todo list in fileName without writing anything
+// back, even if the file needs migrating. A missing file is an empty list.
+func readTodosFile(fileName string) (Todos, error) {
+	data, err := os.ReadFile(fileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Todos{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	backend := NewMemoryBackend()
+	backend.Write(data)
+
+	todos := Todos{}
+	storage := newTodoStorage(fileName, WithBackend(backend))
+	if err := storage.Load(&todos); err != nil {
+		return nil, err
+	}
+	return todos, nil
+}
+
+func cmdMerge() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("merge", "BASE LOCAL REMOTE", "Merge the changes made to BASE in LOCAL and REMOTE and write the result to LOCAL.\n"+
+		"It can be used as a git merge driver: todo merge %O %A %B")
+	output := fs.String("o", "", "write the result to this file instead of LOCAL")
+	strict := fs.Bool("strict", false, "fail when both sides changed the same field")
+	return fs, func(rest []string) error {
+		if len(rest) != 3 {
+			return usagef("expected BASE, LOCAL and REMOTE files")
+		}
+		out := *output
+		if out == "" {
+			out = rest[1]
+		}
+
+		base, err := readTodosFile(rest[0])
+		if err != nil {
+			return err
+		}
+		remote, err := readTodosFile(rest[2])
+		if err != nil {
+			return err
+		}
+
+		// The result holds the todos of all three inputs, so it is encrypted
+		// if any of them is.
+		var opts []StorageOption
+		if isSealedFile(rest[0]) || isSealedFile(rest[1]) || isSealedFile(rest[2]) {
+			opts = append(opts, WithEncryption(passphrases))
+		}
+		storage := newTodoStorage(out, opts...)
+		unlock, err := storage.Lock()
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		// LOCAL is read through the storage, so an encrypted list stays
+		// encrypted.
+		local := Todos{}
+		if out == rest[1] {
+			err = storage.Load(&local)
+		} else {
+			local, err = readTodosFile(rest[1])
+		}
+		if err != nil {
+			return err
+		}
+		r := mergeTodos(base, local, remote)
+		if err := storage.Save(r.Todos); err != nil {
+			return err
+		}
+
+		fmt.Printf("Merged %d todo(s): %d added, %d deleted, %d updated from remote\n", len(r.Todos), r.Added, r.Deleted, r.Updated)
+		for _, c := range r.Conflicts {
+			if c.Field == "deleted" {
+				fmt.Printf("Conflict: %s was deleted on one side and changed on the other; kept the %s version\n", c.ID, c.Winner)
+			} else {
+				fmt.Printf("Conflict: %s %s changed on both sides; kept the %s version\n", c.ID, c.Field, c.Winner)
+			}
+		}
+		if *strict && len(r.Conflicts) > 0 {
+			return fmt.Errorf("%w: %d field(s) changed on both sides", ErrMergeConflict, len(r.Conflicts))
+		}
+		return nil
+	}
+}
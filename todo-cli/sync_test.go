@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// usePassphrase makes the process keyring use pass for the rest of the test.
+func usePassphrase(t *testing.T, pass string) {
+	t.Helper()
+	old := passphrases
+	passphrases = NewKeyring(func() ([]byte, error) { return []byte(pass), nil })
+	t.Cleanup(func() { passphrases = old })
+}
+
+func writeTodos(t *testing.T, fileName string, todos Todos, encrypt bool) {
+	t.Helper()
+	var opts []StorageOption
+	if encrypt {
+		opts = append(opts, WithEncryption(passphrases))
+	}
+	if err := newTodoStorage(fileName, opts...).Save(todos); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMergeKeepsEncryption(t *testing.T) {
+	usePassphrase(t, "secret")
+
+	tests := []struct {
+		name      string
+		encrypted [3]bool // BASE, LOCAL, REMOTE
+	}{
+		{"all encrypted", [3]bool{true, true, true}},
+		{"local encrypted", [3]bool{false, true, false}},
+		{"remote encrypted", [3]bool{false, false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := [3]string{}
+			base := Todos{{ID: "aaaa", Title: "shared secret", Status: StatusTodo}}
+			local := append(cloneTodos(base), Todo{ID: "bbbb", Title: "local secret", Status: StatusTodo})
+			remote := append(cloneTodos(base), Todo{ID: "cccc", Title: "remote secret", Status: StatusTodo})
+			for i, todos := range []Todos{base, local, remote} {
+				files[i] = filepath.Join(dir, []string{"base", "local", "remote"}[i]+".json")
+				writeTodos(t, files[i], todos, tt.encrypted[i])
+			}
+			out := filepath.Join(dir, "out.json")
+
+			if err := runCommand(cmdMerge, []string{"-o", out, files[0], files[1], files[2]}); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !isSealed(data) || bytes.Contains(data, []byte("secret")) {
+				t.Fatalf("merge result is not encrypted:\n%s", data)
+			}
+			merged, err := readTodosFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(merged) != 3 {
+				t.Errorf("merged %d todos, want 3: %+v", len(merged), merged)
+			}
+		})
+	}
+}
+
+func TestMergePlainStaysPlain(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	for _, name := range []string{"base", "local", "remote"} {
+		f := filepath.Join(dir, name+".json")
+		writeTodos(t, f, Todos{{ID: "aaaa", Title: "plain", Status: StatusTodo}}, false)
+		files = append(files, f)
+	}
+	out := filepath.Join(dir, "out.json")
+	if err := runCommand(cmdMerge, append([]string{"-o", out}, files...)); err != nil {
+		t.Fatal(err)
+	}
+	if isSealedFile(out) {
+		t.Error("merging plain files wrote an encrypted result")
+	}
+}
+
+func TestMergeTodos(t *testing.T) {
+	created := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	earlier := created.Add(time.Hour)
+	later := created.Add(2 * time.Hour)
+
+	todo := func(id, title string) Todo {
+		return Todo{ID: id, Title: title, Status: StatusTodo, CreatedAt: created,
+			Transitions: []Transition{{StatusTodo, created}}}
+	}
+	// edited returns t with the field group changed by fn, stamped at at.
+	edited := func(t Todo, group string, at time.Time, fn func(*Todo)) Todo {
+		t.Transitions = slices.Clone(t.Transitions)
+		fn(&t)
+		t.Modified = maps.Clone(t.Modified)
+		if t.Modified == nil {
+			t.Modified = map[string]time.Time{}
+		}
+		t.Modified[group] = at
+		return t
+	}
+	title := func(s string) func(*Todo) { return func(t *Todo) { t.Title = s } }
+	done := func(t *Todo) {
+		t.Status = StatusDone
+		t.Transitions = append(t.Transitions, Transition{StatusDone, later})
+	}
+
+	a, b, c := todo("aaaa", "a"), todo("bbbb", "b"), todo("cccc", "c")
+	base := Todos{a, b, c}
+
+	tests := []struct {
+		name          string
+		local, remote Todos
+		want          Todos
+		conflicts     []mergeConflict
+		added         int
+		deleted       int
+		updated       int
+	}{
+		{
+			name:  "nothing changed",
+			local: base, remote: base,
+			want: base,
+		},
+		{
+			name:   "local edit",
+			local:  Todos{edited(a, "Title", earlier, title("A")), b, c},
+			remote: base,
+			want:   Todos{edited(a, "Title", earlier, title("A")), b, c},
+		},
+		{
+			name:    "remote edit",
+			local:   base,
+			remote:  Todos{a, edited(b, "Title", earlier, title("B")), c},
+			want:    Todos{a, edited(b, "Title", earlier, title("B")), c},
+			updated: 1,
+		},
+		{
+			name:    "both sides, different groups",
+			local:   Todos{edited(a, "Title", later, title("A")), b, c},
+			remote:  Todos{edited(a, "Status", earlier, done), b, c},
+			want:    Todos{edited(edited(a, "Title", later, title("A")), "Status", earlier, done), b, c},
+			updated: 1,
+		},
+		{
+			name:   "same change on both sides",
+			local:  Todos{edited(a, "Status", earlier, done), b, c},
+			remote: Todos{edited(a, "Status", earlier, done), b, c},
+			want:   Todos{edited(a, "Status", earlier, done), b, c},
+		},
+		{
+			name:      "conflict, remote changed last",
+			local:     Todos{edited(a, "Title", earlier, title("local")), b, c},
+			remote:    Todos{edited(a, "Title", later, title("remote")), b, c},
+			want:      Todos{edited(a, "Title", later, title("remote")), b, c},
+			conflicts: []mergeConflict{{"aaaa", "Title", "remote"}},
+			updated:   1,
+		},
+		{
+			name:      "conflict, local changed last",
+			local:     Todos{edited(a, "Title", later, title("local")), b, c},
+			remote:    Todos{edited(a, "Title", earlier, title("remote")), b, c},
+			want:      Todos{edited(a, "Title", later, title("local")), b, c},
+			conflicts: []mergeConflict{{"aaaa", "Title", "local"}},
+		},
+		{
+			name:      "conflict, tie goes to local",
+			local:     Todos{edited(a, "Title", later, title("local")), b, c},
+			remote:    Todos{edited(a, "Title", later, title("remote")), b, c},
+			want:      Todos{edited(a, "Title", later, title("local")), b, c},
+			conflicts: []mergeConflict{{"aaaa", "Title", "local"}},
+		},
+		{
+			name:    "deleted on the remote",
+			local:   base,
+			remote:  Todos{a, c},
+			want:    Todos{a, c},
+			deleted: 1,
+		},
+		{
+			name:   "deleted locally",
+			local:  Todos{a, c},
+			remote: base,
+			want:   Todos{a, c},
+		},
+		{
+			name:      "deleted on the remote, edited locally",
+			local:     Todos{a, edited(b, "Title", earlier, title("B")), c},
+			remote:    Todos{a, c},
+			want:      Todos{a, edited(b, "Title", earlier, title("B")), c},
+			conflicts: []mergeConflict{{"bbbb", "deleted", "local"}},
+		},
+		{
+			name:      "deleted locally, edited on the remote",
+			local:     Todos{a, c},
+			remote:    Todos{a, edited(b, "Title", earlier, title("B")), c},
+			want:      Todos{a, c, edited(b, "Title", earlier, title("B"))},
+			conflicts: []mergeConflict{{"bbbb", "deleted", "remote"}},
+			added:     1,
+		},
+		{
+			name:   "added on both sides",
+			local:  Todos{a, todo("dddd", "local"), b, c},
+			remote: Todos{a, b, c, todo("eeee", "remote"), todo("ffff", "remote 2")},
+			want:   Todos{a, todo("dddd", "local"), b, c, todo("eeee", "remote"), todo("ffff", "remote 2")},
+			added:  2,
+		},
+		{
+			name:      "same ID added on both sides",
+			local:     Todos{a, b, c, todo("dddd", "local")},
+			remote:    Todos{a, b, c, todo("dddd", "remote")},
+			want:      Todos{a, b, c, todo("dddd", "local")},
+			conflicts: []mergeConflict{{"dddd", "Title", "local"}},
+		},
+		{
+			name:   "local order wins",
+			local:  Todos{c, a, b},
+			remote: Todos{b, a, c, todo("dddd", "remote")},
+			want:   Todos{c, a, b, todo("dddd", "remote")},
+			added:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := mergeTodos(cloneTodos(base), cloneTodos(tt.local), cloneTodos(tt.remote))
+			if !sameTodoList(r.Todos, tt.want) {
+				t.Errorf("merged todos:\n got %+v\nwant %+v", r.Todos, tt.want)
+			}
+			if !slices.Equal(r.Conflicts, tt.conflicts) {
+				t.Errorf("conflicts = %v, want %v", r.Conflicts, tt.conflicts)
+			}
+			if r.Added != tt.added || r.Deleted != tt.deleted || r.Updated != tt.updated {
+				t.Errorf("added, deleted, updated = %d, %d, %d; want %d, %d, %d",
+					r.Added, r.Deleted, r.Updated, tt.added, tt.deleted, tt.updated)
+			}
+		})
+	}
+}
+
+func sameTodoList(a, b Todos) bool {
+	return slices.EqualFunc(a, b, sameTodo)
+}
+
+// TestUndoWinsMerge checks that undoing an edit stamps the restored fields,
+// so the next merge prefers the undone state over an older remote change.
+func TestUndoWinsMerge(t *testing.T) {
+	useDataDir(t)
+	start := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	now := start
+	oldClock := clock
+	clock = func() time.Time { return now }
+	t.Cleanup(func() { clock = oldClock })
+	rename := func(title string, hours int) {
+		t.Helper()
+		now = start.Add(time.Duration(hours) * time.Hour)
+		if err := withTodos("edit", func(todos *Todos) error {
+			(*todos)[0].Title = title
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := withTodos("add", func(todos *Todos) error {
+		todos.add("v1")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	base, err := readTodosFile(listFile(defaultList))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Locally the todo is renamed at 10:00 and 11:00, and the second
+	// rename undone at 13:00. The remote renamed it at 12:00.
+	rename("v2", 1)
+	rename("v3", 2)
+	now = start.Add(4 * time.Hour)
+	if err := runCommand(cmdUndo, nil); err != nil {
+		t.Fatal(err)
+	}
+	remote := cloneTodos(base)
+	remote[0].Title = "remote"
+	remote[0].Modified = map[string]time.Time{"Title": start.Add(3 * time.Hour)}
+
+	local, err := readTodosFile(listFile(defaultList))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := mergeTodos(base, local, remote)
+	if len(r.Todos) != 1 || r.Todos[0].Title != "v2" {
+		t.Errorf("merged %+v, want the undone title v2 to win", r.Todos)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// formatPresets are the named templates for list --format. Presets in the
+// config file's "formats" map are added to these and win over them.
+var formatPresets = map[string]string{
+	"oneline": `{{range .Todos}}{{.ID}} {{if .Done}}[x]{{else}}[ ]{{end}} {{indent .Depth}}{{trunc 60 .Title}}` +
+		`{{with .Due}} {{color "yellow" (printf "(due %s)" (rel .))}}{{end}}` + "\n{{end}}",
+	"standup": `Done in the last day:` + "\n" +
+		`{{range .Todos}}{{if and .Done (within "24h" .CompletedAt)}}  - {{.Title}}` + "\n{{end}}{{end}}" +
+		`In progress:` + "\n" +
+		`{{range .Todos}}{{if eq .Status "in-progress"}}  - {{.Title}}{{with .Due}} (due {{rel .}}){{end}}` + "\n{{end}}{{end}}" +
+		`Blocked:` + "\n" +
+		`{{range .Todos}}{{if .Blocked}}  - {{.Title}}` + "\n{{end}}{{end}}",
+}
+
+// formatNames returns the names of all presets, sorted.
+func formatNames() []string {
+	names := slices.Collect(maps.Keys(formatPresets))
+	for name := range global.config.Formats {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// templateData is what list --format templates are executed with.
+type templateData struct {
+	Todos []todoView
+	List  string
+	Now   time.Time
+}
+
+// todoView is a todo with the values templates commonly need worked out.
+type todoView struct {
+	Todo
+	Status      string
+	Done        bool
+	Closed      bool
+	Overdue     bool
+	Blocked     bool
+	Running     bool
+	CompletedAt *time.Time
+	Tracked     time.Duration
+	// Depth is the nesting level of subtasks, 0 for top level todos.
+	Depth int
+}
+
+// parseFormat returns the template named by format, or format itself
+// parsed as a template if no preset has that name.
+func parseFormat(format string, opts listOptions) (*template.Template, error) {
+	text := format
+	if preset, ok := global.config.Formats[format]; ok {
+		text = preset
+	} else if preset, ok := formatPresets[format]; ok {
+		text = preset
+	}
+	// Escapes make one-liners easy to write in a shell.
+	text = strings.NewReplacer(`\n`, "\n", `\t`, "\t").Replace(text)
+
+	tmpl, err := template.New("format").Funcs(templateFuncs(opts)).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid format: %v", err)
+	}
+	return tmpl, nil
+}
+
+// templateColors are the color names accepted by the color template func.
+var templateColors = map[string]string{
+	"red":    ansiRed,
+	"green":  "\033[32m",
+	"yellow": "\033[33m",
+	"blue":   "\033[34m",
+	"bold":   "\033[1m",
+	"dim":    escDim,
+}
+
+func templateFuncs(opts listOptions) template.FuncMap {
+	now := clock()
+	// deref lets the time funcs take both time.Time and *time.Time.
+	deref := func(v any) (time.Time, bool) {
+		switch t := v.(type) {
+		case time.Time:
+			return t, !t.IsZero()
+		case *time.Time:
+			if t != nil {
+				return *t, true
+			}
+		}
+		return time.Time{}, false
+	}
+
+	return template.FuncMap{
+		// rel prints a time relative to now, e.g. "in 3 days".
+		"rel": func(v any) string {
+			t, ok := deref(v)
+			if !ok {
+				return ""
+			}
+			return relativeTime(t, now)
+		},
+		// date formats a time with a layout or a --time-format name.
+		"date": func(layout string, v any) string {
+			t, ok := deref(v)
+			if !ok {
+				return ""
+			}
+			return local(t).Format(listOptions{TimeFormat: layout}.timeLayout(layout))
+		},
+		// within reports whether a time lies in the last d, e.g. "24h".
+		"within": func(d string, v any) (bool, error) {
+			dur, err := time.ParseDuration(d)
+			if err != nil {
+				return false, err
+			}
+			t, ok := deref(v)
+			return ok && !t.After(now) && now.Sub(t) <= dur, nil
+		},
+		// trunc shortens s to at most n characters.
+		"trunc": func(n int, s string) string {
+			if len([]rune(s)) <= n {
+				return s
+			}
+			return strings.TrimRight(fit(s, n), " ")
+		},
+		// pad fills s with spaces to n characters.
+		"pad": func(n int, s string) string {
+			if l := len([]rune(s)); l < n {
+				return s + strings.Repeat(" ", n-l)
+			}
+			return s
+		},
+		"indent": func(depth int) string {
+			return strings.Repeat("  ", depth)
+		},
+		// color wraps s in a color, when colors are enabled.
+		"color": func(name, s string) (string, error) {
+			code, ok := templateColors[name]
+			if !ok {
+				return "", fmt.Errorf("unknown color %q", name)
+			}
+			return opts.colorize(code, s), nil
+		},
+		"duration": formatDuration,
+		"join":     strings.Join,
+		"upper":    strings.ToUpper,
+		"lower":    strings.ToLower,
+	}
+}
+
+// relativeTime describes t relative to now in the largest sensible unit.
+func relativeTime(t, now time.Time) string {
+	d := t.Sub(now)
+	past := d < 0
+	if past {
+		d = -d
+	}
+
+	var s string
+	switch {
+	case d < time.Minute:
+		return "now"
+	case d < time.Hour:
+		s = plural(int(d/time.Minute), "minute")
+	case d < 24*time.Hour:
+		s = plural(int(d/time.Hour), "hour")
+	case d < 30*24*time.Hour:
+		s = plural(int(d/(24*time.Hour)), "day")
+	case d < 365*24*time.Hour:
+		s = plural(int(d/(30*24*time.Hour)), "month")
+	default:
+		s = plural(int(d/(365*24*time.Hour)), "year")
+	}
+	if past {
+		return s + " ago"
+	}
+	return "in " + s
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// renderTemplate executes tmpl with the todos in rows, in tree order.
+func (todos Todos) renderTemplate(w io.Writer, rows Todos, tmpl *template.Template) error {
+	now := clock()
+	rows, depths := treeOrder(rows)
+	data := templateData{List: global.list, Now: local(now)}
+	if data.List == "" {
+		data.List = currentList()
+	}
+	for i, t := range rows {
+		// Templates see times in the configured zone, like every other
+		// output.
+		t.CreatedAt = local(t.CreatedAt)
+		if t.Due != nil {
+			due := local(*t.Due)
+			t.Due = &due
+		}
+		completedAt := t.completedAt()
+		if completedAt != nil {
+			*completedAt = local(*completedAt)
+		}
+		data.Todos = append(data.Todos, todoView{
+			Todo:        t,
+			Status:      string(t.status()),
+			Done:        t.isDone(),
+			Closed:      t.isClosed(),
+			Overdue:     t.isOverdue(now),
+			Blocked:     todos.isBlocked(t),
+			Running:     t.running(),
+			CompletedAt: completedAt,
+			Tracked:     t.tracked(now),
+			Depth:       depths[i],
+		})
+	}
+	return tmpl.Execute(w, data)
+}
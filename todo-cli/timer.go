@@ -0,0 +1,369 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aquasecurity/table"
+)
+
+var (
+	// ErrTimerRunning is returned when starting a timer while another one
+	// is running.
+	ErrTimerRunning = errors.New("a timer is already running")
+	// ErrNoTimer is returned when stopping a timer while none is running.
+	ErrNoTimer = errors.New("no timer is running")
+)
+
+// Session is a period of work on a todo. End is nil while the timer runs.
+type Session struct {
+	Start time.Time
+	End   *time.Time `json:",omitempty"`
+}
+
+// span returns the part of the session between from and to, treating a
+// running session as ending at now. A zero from or to leaves that side
+// open.
+func (s Session) span(from, to, now time.Time) (time.Time, time.Time) {
+	start, end := s.Start, now
+	if s.End != nil {
+		end = *s.End
+	}
+	if !from.IsZero() && start.Before(from) {
+		start = from
+	}
+	if !to.IsZero() && end.After(to) {
+		end = to
+	}
+	return start, end
+}
+
+// running reports whether a timer is running for the todo.
+func (t Todo) running() bool {
+	return len(t.Sessions) > 0 && t.Sessions[len(t.Sessions)-1].End == nil
+}
+
+// tracked returns the total time recorded against the todo up to now.
+func (t Todo) tracked(now time.Time) time.Duration {
+	var total time.Duration
+	for _, s := range t.Sessions {
+		start, end := s.span(time.Time{}, time.Time{}, now)
+		total += end.Sub(start)
+	}
+	return total
+}
+
+// runningIndex returns the index of the todo whose timer is running, or -1.
+func (todos Todos) runningIndex() int {
+	return slices.IndexFunc(todos, Todo.running)
+}
+
+// start begins a work session on the todo with the given ID.
+func (todos *Todos) start(id string, now time.Time) error {
+	index, err := todos.indexOf(id)
+	if err != nil {
+		return err
+	}
+	if running := todos.runningIndex(); running >= 0 {
+		t := (*todos)[running]
+		return fmt.Errorf("%w: %s %q", ErrTimerRunning, t.ID, t.Title)
+	}
+	t := &(*todos)[index]
+	if t.isClosed() {
+		return fmt.Errorf("todo %s is %s", t.ID, t.status())
+	}
+	t.Sessions = append(t.Sessions, Session{Start: now})
+	return nil
+}
+
+// stopTimer ends the running session and returns the todo it belonged to.
+func (todos *Todos) stopTimer(now time.Time) (Todo, error) {
+	index := todos.runningIndex()
+	if index < 0 {
+		return Todo{}, ErrNoTimer
+	}
+	t := &(*todos)[index]
+	t.Sessions[len(t.Sessions)-1].End = &now
+	return *t, nil
+}
+
+// formatDuration prints d rounded to the minute, e.g. "2h05m".
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// runningElsewhere returns the list, other than current, that has a timer
+// running, and that todo.
+func runningElsewhere(current string) (string, Todo, error) {
+	names, err := listNames()
+	if err != nil {
+		return "", Todo{}, err
+	}
+	for _, name := range names {
+		if name == current {
+			continue
+		}
+		var found *Todo
+		err := withStoreFile(listFile(name), false, func(todos *Todos, _ *History) error {
+			if i := todos.runningIndex(); i >= 0 {
+				found = &(*todos)[i]
+			}
+			return nil
+		})
+		if err != nil {
+			return "", Todo{}, err
+		}
+		if found != nil {
+			return name, *found, nil
+		}
+	}
+	return "", Todo{}, nil
+}
+
+// stopIn stops the timer running in the given list, recording the change in
+// that list's undo history.
+func stopIn(name string, now time.Time) error {
+	return withStoreFile(listFile(name), true, func(todos *Todos, history *History) error {
+		before := cloneTodos(*todos)
+		if _, err := todos.stopTimer(now); err != nil {
+			return err
+		}
+		todos.stamp(before, now)
+		history.record("stop", before, *todos)
+		return nil
+	})
+}
+
+func cmdStart() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("start", "ID", "Start tracking time on a todo. Only one timer runs at a time.")
+	switchTimer := fs.Bool("switch", false, "stop the running timer first")
+	return fs, func(rest []string) error {
+		if len(rest) != 1 {
+			return usagef("expected exactly one ID")
+		}
+		id := rest[0]
+
+		name, err := activeList()
+		if err != nil {
+			return err
+		}
+		now := clock()
+
+		// Timers in other lists are checked first, so no two list locks are
+		// ever held at once.
+		other, t, err := runningElsewhere(name)
+		if err != nil {
+			return err
+		}
+		if other != "" {
+			if !*switchTimer {
+				return fmt.Errorf("%w: %s %q in list %q", ErrTimerRunning, t.ID, t.Title, other)
+			}
+			if err := stopIn(other, now); err != nil {
+				return err
+			}
+			fmt.Printf("Stopped %s after %s\n", t.ID, formatDuration(now.Sub(t.Sessions[len(t.Sessions)-1].Start)))
+		}
+
+		return withTodos("start", func(todos *Todos) error {
+			if *switchTimer && todos.runningIndex() >= 0 {
+				stopped, _ := todos.stopTimer(now)
+				fmt.Printf("Stopped %s after %s\n", stopped.ID, formatDuration(now.Sub(stopped.Sessions[len(stopped.Sessions)-1].Start)))
+			}
+			if err := todos.start(id, now); err != nil {
+				return err
+			}
+			fmt.Printf("Started %s\n", normalizeID(id))
+			return nil
+		})
+	}
+}
+
+func cmdStop() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("stop", "", "Stop the running timer.")
+	return fs, func(rest []string) error {
+		var err error
+		if len(rest) > 0 {
+			return usagef("unexpected arguments: %v", rest)
+		}
+		now := clock()
+
+		err = withTodos("stop", func(todos *Todos) error {
+			t, err := todos.stopTimer(now)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Stopped %s after %s (%s in total)\n", t.ID, formatDuration(now.Sub(t.Sessions[len(t.Sessions)-1].Start)), formatDuration(t.tracked(now)))
+			return nil
+		})
+		if !errors.Is(err, ErrNoTimer) {
+			return err
+		}
+
+		// The timer may have been started in another list.
+		name, err := activeList()
+		if err != nil {
+			return err
+		}
+		other, t, err := runningElsewhere(name)
+		if err != nil {
+			return err
+		}
+		if other == "" {
+			return ErrNoTimer
+		}
+		if err := stopIn(other, now); err != nil {
+			return err
+		}
+		fmt.Printf("Stopped %s in list %q after %s\n", t.ID, other, formatDuration(now.Sub(t.Sessions[len(t.Sessions)-1].Start)))
+		return nil
+	}
+}
+
+// reportGroupings are the ways tracked time can be summarized.
+var reportGroupings = []string{"item", "tag", "day"}
+
+// timeReport sums tracked time per todo, per tag and per day.
+type timeReport struct {
+	items map[string]time.Duration
+	tags  map[string]time.Duration
+	days  map[string]time.Duration
+	total time.Duration
+}
+
+// newTimeReport sums the sessions of todos between from and to. Sessions
+// running past midnight are split between the days.
+func newTimeReport(todos Todos, from, to, now time.Time) timeReport {
+	r := timeReport{
+		items: map[string]time.Duration{},
+		tags:  map[string]time.Duration{},
+		days:  map[string]time.Duration{},
+	}
+	for _, t := range todos {
+		for _, s := range t.Sessions {
+			start, end := s.span(from, to, now)
+			if !end.After(start) {
+				continue
+			}
+			d := end.Sub(start)
+			r.items[t.ID] += d
+			r.total += d
+			if len(t.Tags) == 0 {
+				r.tags["(untagged)"] += d
+			}
+			for _, tag := range t.Tags {
+				r.tags[tag] += d
+			}
+			for day := local(start); day.Before(end); {
+				y, m, dd := day.Date()
+				next := time.Date(y, m, dd+1, 0, 0, 0, 0, day.Location())
+				if next.After(end) {
+					next = end
+				}
+				r.days[day.Format(dayFormat)] += next.Sub(day)
+				day = next
+			}
+		}
+	}
+	return r
+}
+
+func cmdReport() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("report", "", "Summarize tracked time per item, per tag and per day.")
+	from := fs.String("from", "", "first day to include, "+dateHelp)
+	to := fs.String("to", "", "last day to include, "+dateHelp)
+	by := fs.String("by", "", "only show one summary: "+strings.Join(reportGroupings, ", "))
+	ascii := fs.Bool("ascii", false, "use plain ASCII box drawing characters")
+	return fs, func(rest []string) error {
+		var err error
+		if len(rest) > 0 {
+			return usagef("unexpected arguments: %v", rest)
+		}
+		if *by != "" && !slices.Contains(reportGroupings, *by) {
+			return usagef("invalid grouping %q (want %s)", *by, strings.Join(reportGroupings, ", "))
+		}
+		var start, end time.Time
+		if *from != "" {
+			if start, err = parseDay(*from); err != nil {
+				return usagef("--from: %v", err)
+			}
+		}
+		if *to != "" {
+			if end, err = parseDay(*to); err != nil {
+				return usagef("--to: %v", err)
+			}
+			end = end.AddDate(0, 0, 1)
+		}
+
+		return withTodos("", func(todos *Todos) error {
+			r := newTimeReport(*todos, start, end, clock())
+			titles := map[string]string{}
+			for _, t := range *todos {
+				titles[t.ID] = t.Title
+			}
+
+			dividers := table.UnicodeDividers
+			if *ascii {
+				dividers = table.ASCIIDividers
+			}
+			section := func(headers []string, rows [][]string) {
+				tbl := table.New(os.Stdout)
+				tbl.SetDividers(dividers)
+				tbl.SetRowLines(false)
+				tbl.SetHeaders(headers...)
+				tbl.AddRows(rows...)
+				tbl.SetFooters(append(make([]string, len(headers)-2), "Total", formatDuration(r.total))...)
+				tbl.Render()
+			}
+			// byDuration orders keys by descending time, then by name.
+			byDuration := func(m map[string]time.Duration) []string {
+				keys := make([]string, 0, len(m))
+				for k := range m {
+					keys = append(keys, k)
+				}
+				sort.Slice(keys, func(i, j int) bool {
+					if m[keys[i]] != m[keys[j]] {
+						return m[keys[i]] > m[keys[j]]
+					}
+					return keys[i] < keys[j]
+				})
+				return keys
+			}
+
+			if *by == "" || *by == "item" {
+				var rows [][]string
+				for _, id := range byDuration(r.items) {
+					rows = append(rows, []string{id, titles[id], formatDuration(r.items[id])})
+				}
+				section([]string{"ID", "Title", "Time"}, rows)
+			}
+			if *by == "" || *by == "tag" {
+				var rows [][]string
+				for _, tag := range byDuration(r.tags) {
+					rows = append(rows, []string{tag, formatDuration(r.tags[tag])})
+				}
+				section([]string{"Tag", "Time"}, rows)
+			}
+			if *by == "" || *by == "day" {
+				var days []string
+				for day := range r.days {
+					days = append(days, day)
+				}
+				sort.Strings(days)
+				var rows [][]string
+				for _, day := range days {
+					rows = append(rows, []string{day, formatDuration(r.days[day])})
+				}
+				section([]string{"Day", "Time"}, rows)
+			}
+			return nil
+		})
+	}
+}
@@ -1,104 +1,302 @@
 package main
 
 import (
-	"errors"
 	"fmt"
-	"os"
-	"strconv"
+	"io"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/aquasecurity/table"
 )
 
 type Todo struct {
+	ID string
 	Title string
-	Completed bool
+	Status Status
 	CreatedAt time.Time
-	CompletedAt *time.Time
+	Transitions []Transition `json:",omitempty"`
+	Due *time.Time `json:",omitempty"`
+	Priority Priority `json:",omitempty"`
+	Tags []string `json:",omitempty"`
+	Recur *Recurrence `json:",omitempty"`
+	ParentID string `json:",omitempty"`
+	BlockedBy []string `json:",omitempty"`
+	Sessions []Session `json:",omitempty"`
+	// Modified records when each group of fields was last changed, see
+	// syncFields.
+	Modified map[string]time.Time `json:",omitempty"`
 }
 
 type Todos []Todo
 
 func (todos *Todos) add(title string) {
-	todo := Todo{
-		Title: title,
-		Completed: false,
-		CompletedAt: nil,
-		CreatedAt: time.Now(),
-	}
+	todos.addTodo(Todo{Title: title})
+}
+
+// addTodo appends todo as a new item in the todo status and returns its ID.
+// Optional fields such as Due, Priority and Tags are kept as given.
+func (todos *Todos) addTodo(todo Todo) string {
+	todo.ID = todos.newID()
+	todo.Status = StatusTodo
+	todo.CreatedAt = clock()
+	todo.Transitions = []Transition{{Status: StatusTodo, At: todo.CreatedAt}}
 
 	*todos = append(*todos, todo)
+
+	return todo.ID
 }
 
 func (todos *Todos) validateIndex(index int) error{
 	if index < 0 || index >= len(*todos){
-		err := errors.New("Invalid index")
-		fmt.Println(err)
-		return err
+		return fmt.Errorf("%w: %d", ErrInvalidIndex, index)
 	}
 	return nil
 }
 
-func (todos *Todos) delete(index int) error {
+func (todos *Todos) indexOf(id string) (int, error){
+	id = normalizeID(id)
+
+	for index, t := range *todos {
+		if t.ID == id{
+			return index, nil
+		}
+	}
+	return -1, fmt.Errorf("%w: %q", ErrNotFound, id)
+}
+
+// delete removes the todo with the given ID. Its subtasks are removed too
+// or moved up to its parent, depending on policy.
+func (todos *Todos) delete(id string, policy orphanPolicy) error {
 	t:= *todos
 
-	if err := t.validateIndex(index); err != nil{
-		return nil
+	index, err := t.indexOf(id)
+	if err != nil{
+		return err
+	}
+	deleted := t[index]
+
+	remove := map[string]bool{deleted.ID: true}
+	if policy == orphanCascade {
+		for _, child := range t.descendants(deleted.ID) {
+			remove[child] = true
+		}
+	} else {
+		for i := range t {
+			if t[i].ParentID == deleted.ID {
+				t[i].ParentID = deleted.ParentID
+			}
+		}
 	}
-	*todos = append(t[:index],t[index+1:]...)
+	*todos = slices.DeleteFunc(t, func(todo Todo) bool { return remove[todo.ID] })
+	todos.dropBlockers()
 
 	return nil
 }
 
-func (todos *Todos) toggle(index int) error{
+// toggle marks the todo with the given ID as done, or back to todo if it
+// already is done. With cascade its subtasks, at any depth, that were in the
+// same state follow it where the workflow allows. Todos with open blockers
+// are only completed with force.
+func (todos *Todos) toggle(id string, cascade, force bool) error{
 	t:= *todos
 
-	if err := t.validateIndex(index); err != nil{
-		return nil
+	index, err := t.indexOf(id)
+	if err != nil{
+		return err
+	}
+	wasDone := t[index].isDone()
+	target := StatusDone
+	if wasDone {
+		target = StatusTodo
+	} else if !force {
+		if err := t.checkBlockers(index); err != nil {
+			return err
+		}
 	}
-	isCompleted := t[index].Completed
-	if !isCompleted{
-		completionTime := time.Now()
-		t[index].CompletedAt = &completionTime
+	if err := todos.changeStatus(index, target); err != nil {
+		return err
 	}
 
-	t[index].Completed = !isCompleted
+	if cascade {
+		for _, child := range todos.descendants((*todos)[index].ID) {
+			if i, err := todos.indexOf(child); err == nil && (*todos)[i].isDone() == wasDone {
+				// Subtasks the workflow or their blockers won't let
+				// move are left as they are.
+				if target == StatusDone && !force && todos.checkBlockers(i) != nil {
+					continue
+				}
+				todos.changeStatus(i, target)
+			}
+		}
+	}
 
 	return nil
 }
 
-func (todos *Todos) edit(index int, title string) error{
-	t:= *todos
+// spawnNext adds the next instance of the recurring todo at index, which has
+// just been completed. The recurrence moves to the new instance, so toggling
+// the completed one again doesn't spawn a second copy.
+func (todos *Todos) spawnNext(index int) {
+	done := (*todos)[index]
+	due := done.Recur.next(done.Due, local(*done.completedAt()))
 
-	if err := t.validateIndex(index); err != nil{
+	next := Todo{
+		Title: done.Title,
+		Priority: done.Priority,
+		Tags: slices.Clone(done.Tags),
+		Recur: done.Recur,
+		Due: &due,
+		ParentID: done.ParentID,
+	}
+	(*todos)[index].Recur = nil
+	todos.addTodo(next)
+}
+
+func (todos *Todos) edit(id string, title string) error{
+	return todos.update(id, func(t *Todo) error {
+		t.Title = title
 		return nil
+	})
+}
+
+// update applies fn to the todo with the given ID.
+func (todos *Todos) update(id string, fn func(t *Todo) error) error{
+	t:= *todos
+
+	index, err := t.indexOf(id)
+	if err != nil{
+		return err
 	}
 
+	return fn(&t[index])
+}
+
+// move places the todo with the given ID at index, shifting the others.
+func (todos *Todos) move(id string, index int) error{
+	t:= *todos
+
+	from, err := t.indexOf(id)
+	if err != nil{
+		return err
+	}
+	if err := t.validateIndex(index); err != nil{
+		return err
+	}
 
-	t[index].Title = title
+	todo := t[from]
+	t = append(t[:from], t[from+1:]...)
+	t = append(t[:index], append(Todos{todo}, t[index:]...)...)
+	*todos = t
 
 	return nil
 }
 
-func (todos *Todos) print(){
-	table := table.New(os.Stdout)
+// clearCompleted removes all done and cancelled todos.
+func (todos *Todos) clearCompleted() int{
+	return len(todos.removeWhere(Todo.isClosed))
+}
+
+// removeWhere removes the todos matching drop and returns them. Kept
+// subtasks of removed todos move up to the nearest kept ancestor.
+func (todos *Todos) removeWhere(drop func(Todo) bool) Todos{
+	kept := Todos{}
+	var removed Todos
+	parents := map[string]string{}
+	dropped := map[string]bool{}
+
+	for _, t := range *todos {
+		parents[t.ID] = t.ParentID
+		if drop(t){
+			dropped[t.ID] = true
+			removed = append(removed, t)
+		} else {
+			kept = append(kept, t)
+		}
+	}
+	for i := range kept {
+		for steps := 0; dropped[kept[i].ParentID] && steps < len(parents); steps++ {
+			kept[i].ParentID = parents[kept[i].ParentID]
+		}
+		if dropped[kept[i].ParentID] {
+			kept[i].ParentID = ""
+		}
+	}
+	*todos = kept
+	todos.dropBlockers()
+
+	return removed
+}
+
+func (todos *Todos) print(w io.Writer, opts listOptions) error{
+	now := clock()
+	rows := todos.filter(opts, now)
+
+	if opts.Template != nil {
+		return todos.renderTemplate(w, rows, opts.Template)
+	}
+	if opts.Output != "" && opts.Output != "table" {
+		return render(w, rows, opts)
+	}
+	if opts.Kanban {
+		return printKanban(w, rows, opts)
+	}
+	rows, depths := treeOrder(rows)
+
+	dividers := table.UnicodeDividers
+	if opts.ASCII {
+		dividers = table.ASCIIDividers
+	}
+	table := table.New(w)
+	timeFormat := opts.timeLayout(time.RFC1123)
 
 	table.SetRowLines(false)
-	table.SetHeaders("#", "Title","Completed", "Created at", "Completed at")
+	table.SetHeaders("ID", "Title","Status", "Priority", "Due", "Tags", "Created at", "Completed at")
+	table.SetDividers(dividers)
 
-	for index, t := range *todos {
-		completed := "❎"
+	for row, t := range rows {
+		status := statusMarker(t.status(), opts.ASCII) + " " + string(t.status())
 		completedAt := ""
 
-		if t.Completed{
-			completed ="✅"
-			if t.CompletedAt != nil {
-				completedAt = t.CompletedAt.Format(time.RFC1123)
+		if at := t.completedAt(); at != nil{
+			completedAt = local(*at).Format(timeFormat)
+		}
+
+		due := ""
+		if t.Due != nil {
+			due = local(*t.Due).Format(opts.timeLayout(dueFormat))
+			if t.isOverdue(now) {
+				due = opts.colorize(ansiRed, due + " (overdue)")
 			}
 		}
+		if t.Recur != nil {
+			due = strings.TrimSpace(due + " [" + t.Recur.String() + "]")
+		}
 
-		table.AddRow(strconv.Itoa(index), t.Title, completed, t.CreatedAt.Format(time.RFC1123), completedAt)
+		title := t.Title
+		if depths[row] > 0 {
+			// The table collapses runs of spaces, so the indentation
+			// uses guide lines and no-break spaces.
+			guide, branch := "│\u00a0\u00a0", "└─ "
+			if opts.ASCII {
+				guide, branch = "|\u00a0\u00a0", "`- "
+			}
+			title = strings.Repeat(guide, depths[row]-1) + branch + title
+		}
+		if done, total := todos.progress(t.ID); total > 0 {
+			title += fmt.Sprintf(" (%d/%d)", done, total)
+		}
+		if t.running() {
+			title += " [running]"
+		}
+		blocked := todos.openBlockers(t)
+		if len(blocked) > 0 {
+			title = opts.colorize(escDim, title + " [blocked by " + strings.Join(blocked, ", ") + "]")
+		}
+
+		table.AddRow(t.ID, title, status, string(t.Priority), due, strings.Join(t.Tags, ", "), local(t.CreatedAt).Format(timeFormat), completedAt)
 	}
 
 	table.Render()
+	return nil
 }
@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+// useDefaultConfig resets the settings to their defaults for the rest of
+// the test.
+func useDefaultConfig(t *testing.T) {
+	t.Helper()
+	old := global.config
+	global.config = defaultConfig()
+	t.Cleanup(func() { global.config = old })
+}
+
+func TestToggleCascade(t *testing.T) {
+	useDefaultConfig(t)
+
+	// IDs are matched case-insensitively, so the subtasks must be found by
+	// the resolved ID rather than the argument as typed.
+	for _, arg := range []string{"a2b3", "A2B3", " a2b3 "} {
+		t.Run(arg, func(t *testing.T) {
+			todos := Todos{
+				{ID: "a2b3", Title: "parent", Status: StatusTodo},
+				{ID: "c4d5", Title: "child", Status: StatusTodo, ParentID: "a2b3"},
+				{ID: "e6f7", Title: "grandchild", Status: StatusTodo, ParentID: "c4d5"},
+			}
+			if err := todos.toggle(arg, true, false); err != nil {
+				t.Fatal(err)
+			}
+			for _, todo := range todos {
+				if !todo.isDone() {
+					t.Errorf("%s is %s after toggle --cascade %q, want done", todo.Title, todo.status(), arg)
+				}
+			}
+
+			if err := todos.toggle(arg, true, false); err != nil {
+				t.Fatal(err)
+			}
+			for _, todo := range todos {
+				if todo.isDone() {
+					t.Errorf("%s is still done after toggling %q back", todo.Title, arg)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// orphanPolicy decides what happens to the subtasks of a deleted todo.
+type orphanPolicy int
+
+const (
+	// orphanReparent moves subtasks up to the deleted todo's parent.
+	orphanReparent orphanPolicy = iota
+	// orphanCascade deletes subtasks along with their parent.
+	orphanCascade
+)
+
+func parseOrphanPolicy(s string) (orphanPolicy, error) {
+	switch s {
+	case "reparent":
+		return orphanReparent, nil
+	case "cascade":
+		return orphanCascade, nil
+	}
+	return orphanReparent, fmt.Errorf("invalid orphan policy %q (want reparent or cascade)", s)
+}
+
+// ErrParentCycle is returned when a todo would become its own ancestor.
+var ErrParentCycle = errors.New("a todo cannot be placed under itself or its own subtasks")
+
+// descendants returns the IDs of all subtasks of id, at any depth.
+func (todos Todos) descendants(id string) []string {
+	var ids []string
+	queue := []string{id}
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+		for _, t := range todos {
+			if t.ParentID == parent && t.ID != id {
+				ids = append(ids, t.ID)
+				queue = append(queue, t.ID)
+			}
+		}
+	}
+	return ids
+}
+
+// setParent makes parentID the parent of id. An empty parentID turns id into
+// a top level todo.
+func (todos *Todos) setParent(id, parentID string) error {
+	parentID = normalizeID(parentID)
+	if parentID != "" {
+		if _, err := todos.indexOf(parentID); err != nil {
+			return err
+		}
+	}
+	return todos.update(id, func(t *Todo) error {
+		if parentID == t.ID {
+			return ErrParentCycle
+		}
+		for _, child := range todos.descendants(t.ID) {
+			if child == parentID {
+				return ErrParentCycle
+			}
+		}
+		t.ParentID = parentID
+		return nil
+	})
+}
+
+// progress returns how many of the direct subtasks of id are closed, and
+// how many there are.
+func (todos Todos) progress(id string) (done, total int) {
+	for _, t := range todos {
+		if t.ParentID == id {
+			total++
+			if t.isClosed() {
+				done++
+			}
+		}
+	}
+	return done, total
+}
+
+// treeOrder arranges rows depth-first, each parent followed by its subtasks,
+// and returns the depth of every row. Siblings keep their order in rows. A
+// todo whose parent is not among rows is shown at the top level.
+func treeOrder(rows Todos) (Todos, []int) {
+	present := map[string]bool{}
+	for _, t := range rows {
+		present[t.ID] = true
+	}
+	children := map[string][]int{}
+	var roots []int
+	for i, t := range rows {
+		if t.ParentID != "" && present[t.ParentID] {
+			children[t.ParentID] = append(children[t.ParentID], i)
+		} else {
+			roots = append(roots, i)
+		}
+	}
+
+	ordered := make(Todos, 0, len(rows))
+	depths := make([]int, 0, len(rows))
+	visited := make([]bool, len(rows))
+	var walk func(i, depth int)
+	walk = func(i, depth int) {
+		if visited[i] {
+			return
+		}
+		visited[i] = true
+		ordered = append(ordered, rows[i])
+		depths = append(depths, depth)
+		for _, child := range children[rows[i].ID] {
+			walk(child, depth+1)
+		}
+	}
+	for _, root := range roots {
+		walk(root, 0)
+	}
+	// Todos caught in a parent cycle (only possible with hand edited or
+	// imported data) are never reached from a root; show them anyway.
+	for i := range rows {
+		walk(i, 0)
+	}
+	return ordered, depths
+}
@@ -0,0 +1,541 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// ANSI sequences used by the interactive mode.
+const (
+	escAltScreenOn  = "\033[?1049h"
+	escAltScreenOff = "\033[?1049l"
+	escHideCursor   = "\033[?25l"
+	escShowCursor   = "\033[?25h"
+	escClear        = "\033[H\033[2J"
+	escReverse      = "\033[7m"
+	escDim          = "\033[2m"
+)
+
+// Keys produced by readKeys for sequences that aren't a single rune.
+const (
+	keyUp rune = -(iota + 1)
+	keyDown
+	keyLeft
+	keyRight
+	keyEnter
+	keyEscape
+	keyBackspace
+	keyCtrlC
+	// keyNone stands for escape sequences that are read but ignored.
+	keyNone
+)
+
+type uiMode int
+
+const (
+	modeNormal uiMode = iota
+	modeEdit
+	modeAdd
+	modeFilter
+	modeConfirmDelete
+)
+
+// ui is the state of the interactive full-screen mode. Every change is
+// applied through withTodos, so it is locked, saved and recorded in the undo
+// history exactly like the one-shot commands.
+type ui struct {
+	todos   Todos
+	cursor  int
+	offset  int
+	filter  string
+	mode    uiMode
+	input   []rune
+	message string
+}
+
+func cmdUI() (*flag.FlagSet, func(args []string) error) {
+	fs := newFlagSet("ui", "", "Browse and edit todos in an interactive full-screen view.")
+	return fs, func(rest []string) error {
+		if len(rest) > 0 {
+			return usagef("unexpected arguments: %v", rest)
+		}
+		if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+			return errors.New("the interactive mode needs a terminal")
+		}
+
+		u := &ui{}
+		if err := u.reload(); err != nil {
+			return err
+		}
+
+		restore, err := enterFullScreen()
+		if err != nil {
+			return err
+		}
+		defer restore()
+
+		keys := make(chan rune)
+		go readKeys(os.Stdin, keys)
+
+		for {
+			u.draw()
+			key, ok := <-keys
+			if !ok || !u.handle(key) {
+				return nil
+			}
+		}
+	}
+}
+
+// enterFullScreen switches the terminal to raw mode on the alternate screen.
+// The returned function puts everything back; it also runs if the process
+// is asked to terminate.
+func enterFullScreen() (restore func(), err error) {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Print(escAltScreenOn + escHideCursor)
+
+	reset := func() {
+		fmt.Print(escShowCursor + escAltScreenOff)
+		term.Restore(fd, state)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		if _, ok := <-signals; ok {
+			reset()
+			os.Exit(exitError)
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(signals)
+		reset()
+	}, nil
+}
+
+// escTimeout is how long an ESC that may start an escape sequence waits
+// for the rest of it before it counts as the Escape key.
+const escTimeout = 50 * time.Millisecond
+
+// readKeys decodes terminal input into runes and the key constants above.
+func readKeys(r io.Reader, keys chan<- rune) {
+	defer close(keys)
+	chunks := make(chan []byte)
+	go func() {
+		defer close(chunks)
+		for {
+			buf := make([]byte, 256)
+			n, err := r.Read(buf)
+			if n > 0 {
+				chunks <- buf[:n]
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var pending []byte
+	var timeout <-chan time.Time
+	for {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				return
+			}
+			pending = append(pending, chunk...)
+		case <-timeout:
+			// Nothing completed the sequence, so the ESC was a key
+			// press of its own.
+			keys <- keyEscape
+			pending = pending[1:]
+		}
+
+		timeout = nil
+		for len(pending) > 0 {
+			key, size := decodeKey(pending)
+			if size == 0 {
+				break
+			}
+			pending = pending[size:]
+			if key != keyNone {
+				keys <- key
+			}
+		}
+		if len(pending) > 0 && pending[0] == '\033' {
+			timeout = time.After(escTimeout)
+		}
+	}
+}
+
+// decodeKey returns the first key in b and its length in bytes, or a length
+// of 0 if b holds an incomplete UTF-8 or escape sequence. Escape sequences
+// for keys the interactive mode doesn't use decode to keyNone.
+func decodeKey(b []byte) (rune, int) {
+	switch b[0] {
+	case '\033':
+		return decodeEscape(b)
+	case '\r', '\n':
+		return keyEnter, 1
+	case 127, '\b':
+		return keyBackspace, 1
+	case 3:
+		return keyCtrlC, 1
+	}
+	if !utf8.FullRune(b) {
+		return 0, 0
+	}
+	return utf8.DecodeRune(b)
+}
+
+// arrowKeys maps the final byte of CSI and SS3 cursor key sequences to keys.
+var arrowKeys = map[byte]rune{'A': keyUp, 'B': keyDown, 'C': keyRight, 'D': keyLeft}
+
+// decodeEscape decodes the escape sequence at the start of b. CSI sequences
+// (ESC [, parameter and intermediate bytes, then a final byte in 0x40-0x7E)
+// and SS3 sequences (ESC O and one byte) are consumed whole, so keys such as
+// Home, Delete or PgUp don't leave stray bytes behind. An ESC that starts
+// neither is the Escape key.
+func decodeEscape(b []byte) (rune, int) {
+	if len(b) == 1 {
+		return 0, 0
+	}
+	switch b[1] {
+	case '[':
+		for i := 2; i < len(b); i++ {
+			switch c := b[i]; {
+			case c >= 0x40 && c <= 0x7e:
+				// Modified arrows such as ESC [1;5A still move.
+				if key, ok := arrowKeys[c]; ok {
+					return key, i + 1
+				}
+				return keyNone, i + 1
+			case c < 0x20 || c > 0x3f:
+				return keyEscape, 1
+			}
+		}
+		return 0, 0
+	case 'O':
+		if len(b) == 2 {
+			return 0, 0
+		}
+		if key, ok := arrowKeys[b[2]]; ok {
+			return key, 3
+		}
+		return keyNone, 3
+	}
+	return keyEscape, 1
+}
+
+// reload reads the list from storage.
+func (u *ui) reload() error {
+	return withTodos("", func(todos *Todos) error {
+		u.todos = cloneTodos(*todos)
+		return nil
+	})
+}
+
+// do applies fn to the stored list as the operation op and refreshes the
+// view from the result.
+func (u *ui) do(op string, fn func(todos *Todos) error) {
+	err := withTodos(op, func(todos *Todos) error {
+		if err := fn(todos); err != nil {
+			return err
+		}
+		u.todos = cloneTodos(*todos)
+		return nil
+	})
+	if err != nil {
+		u.message = err.Error()
+	}
+}
+
+// visible returns the indexes of the todos matching the filter, arranged as
+// a tree, and the depth of each.
+func (u *ui) visible() (rows, depths []int) {
+	var matching Todos
+	needle := strings.ToLower(u.filter)
+	for _, t := range u.todos {
+		if needle == "" || strings.Contains(strings.ToLower(t.Title), needle) || t.hasTag(needle) {
+			matching = append(matching, t)
+		}
+	}
+
+	ordered, depths := treeOrder(matching)
+	for _, t := range ordered {
+		index, _ := u.todos.indexOf(t.ID)
+		rows = append(rows, index)
+	}
+	return rows, depths
+}
+
+// cursorTo moves the cursor onto the todo with the given ID, if visible.
+func (u *ui) cursorTo(id string) {
+	rows, _ := u.visible()
+	for k, index := range rows {
+		if u.todos[index].ID == id {
+			u.cursor = k
+			return
+		}
+	}
+}
+
+// sibling returns the list index of the nearest todo before (step -1) or
+// after (step 1) t that has the same parent.
+func (u *ui) sibling(t Todo, step int) (int, bool) {
+	index, err := u.todos.indexOf(t.ID)
+	if err != nil {
+		return 0, false
+	}
+	for i := index + step; i >= 0 && i < len(u.todos); i += step {
+		if u.todos[i].ParentID == t.ParentID {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// selected returns the todo under the cursor.
+func (u *ui) selected() (Todo, bool) {
+	rows, _ := u.visible()
+	if u.cursor < 0 || u.cursor >= len(rows) {
+		return Todo{}, false
+	}
+	return u.todos[rows[u.cursor]], true
+}
+
+// handle processes one key and reports whether the UI should keep running.
+func (u *ui) handle(key rune) bool {
+	if key == keyCtrlC {
+		return false
+	}
+	if u.mode != modeNormal {
+		u.handleInput(key)
+		return true
+	}
+
+	u.message = ""
+	rows, _ := u.visible()
+	current, ok := u.selected()
+
+	switch key {
+	case 'q', keyEscape:
+		return false
+	case 'j', keyDown:
+		u.cursor = min(u.cursor+1, len(rows)-1)
+	case 'k', keyUp:
+		u.cursor = max(u.cursor-1, 0)
+	case 'g':
+		u.cursor = 0
+	case 'G':
+		u.cursor = len(rows) - 1
+	case ' ', 'x':
+		if ok {
+			u.do("toggle", func(todos *Todos) error { return todos.toggle(current.ID, false, false) })
+		}
+	case 'e', keyEnter:
+		if ok {
+			u.mode = modeEdit
+			u.input = []rune(current.Title)
+		}
+	case 'a':
+		u.mode = modeAdd
+		u.input = nil
+	case 'd':
+		if ok {
+			u.mode = modeConfirmDelete
+		}
+	case 'J', 'K':
+		// Reordering swaps a todo with its neighbouring sibling, so
+		// subtasks stay under their parent.
+		if ok && u.filter == "" {
+			step := 1
+			if key == 'K' {
+				step = -1
+			}
+			index, found := u.sibling(current, step)
+			if !found {
+				break
+			}
+			u.do("move", func(todos *Todos) error { return todos.move(current.ID, index) })
+			u.cursorTo(current.ID)
+		} else if u.filter != "" {
+			u.message = "clear the filter to reorder"
+		}
+	case '/':
+		u.mode = modeFilter
+		u.input = []rune(u.filter)
+	case 'r':
+		if err := u.reload(); err != nil {
+			u.message = err.Error()
+		}
+	}
+
+	rows, _ = u.visible()
+	u.cursor = max(min(u.cursor, len(rows)-1), 0)
+	return true
+}
+
+// handleInput processes a key while a line of text is being entered.
+func (u *ui) handleInput(key rune) {
+	current, ok := u.selected()
+
+	if u.mode == modeConfirmDelete {
+		if (key == 'y' || key == 'Y') && ok {
+			u.do("delete", func(todos *Todos) error { return todos.delete(current.ID, orphanReparent) })
+		}
+		u.mode = modeNormal
+		rows, _ := u.visible()
+		u.cursor = max(min(u.cursor, len(rows)-1), 0)
+		return
+	}
+
+	switch key {
+	case keyEscape:
+		if u.mode == modeFilter {
+			u.filter = ""
+		}
+		u.mode = modeNormal
+		return
+	case keyBackspace:
+		if len(u.input) > 0 {
+			u.input = u.input[:len(u.input)-1]
+		}
+	case keyEnter:
+		text := strings.TrimSpace(string(u.input))
+		switch u.mode {
+		case modeEdit:
+			if ok && text != "" {
+				u.do("edit", func(todos *Todos) error { return todos.edit(current.ID, text) })
+			}
+		case modeAdd:
+			if text != "" {
+				u.do("add", func(todos *Todos) error {
+					todos.add(text)
+					return nil
+				})
+				u.filter = ""
+				u.cursor = len(u.todos) - 1
+			}
+		case modeFilter:
+			u.filter = text
+			u.cursor = 0
+		}
+		u.mode = modeNormal
+	default:
+		if key >= ' ' {
+			u.input = append(u.input, key)
+		}
+	}
+
+	if u.mode == modeFilter {
+		// Filter as you type.
+		u.filter = string(u.input)
+		u.cursor = 0
+	}
+}
+
+func (u *ui) draw() {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		width, height = 80, 24
+	}
+	now := clock()
+
+	var b strings.Builder
+	b.WriteString(escClear)
+	title := fmt.Sprintf(" %s — %d todo(s)", programName, len(u.todos))
+	if u.filter != "" {
+		title += fmt.Sprintf(", filter: %q", u.filter)
+	}
+	b.WriteString(escReverse + fit(title, width) + ansiReset + "\r\n")
+
+	rows, depths := u.visible()
+	listHeight := max(height-3, 1)
+	if u.cursor < u.offset {
+		u.offset = u.cursor
+	}
+	if u.cursor >= u.offset+listHeight {
+		u.offset = u.cursor - listHeight + 1
+	}
+
+	for line := 0; line < listHeight; line++ {
+		k := u.offset + line
+		if k >= len(rows) {
+			b.WriteString("\r\n")
+			continue
+		}
+		t := u.todos[rows[k]]
+		mark := statusMarker(t.status(), true)
+		text := fmt.Sprintf(" %s %-5s %s%s", mark, t.ID, strings.Repeat("  ", depths[k]), t.Title)
+		if done, total := u.todos.progress(t.ID); total > 0 {
+			text += fmt.Sprintf(" (%d/%d)", done, total)
+		}
+		if t.Due != nil {
+			text += "  due " + local(*t.Due).Format(dueFormat)
+			if t.isOverdue(now) {
+				text += " (overdue)"
+			}
+		}
+		if len(t.Tags) > 0 {
+			text += "  #" + strings.Join(t.Tags, " #")
+		}
+		text = fit(text, width)
+
+		switch {
+		case k == u.cursor:
+			b.WriteString(escReverse + text + ansiReset)
+		case t.isClosed() || u.todos.isBlocked(t):
+			b.WriteString(escDim + text + ansiReset)
+		case t.isOverdue(now):
+			b.WriteString(ansiRed + text + ansiReset)
+		default:
+			b.WriteString(text)
+		}
+		b.WriteString("\r\n")
+	}
+
+	switch u.mode {
+	case modeEdit:
+		b.WriteString("Edit: " + string(u.input) + "█\r\n")
+	case modeAdd:
+		b.WriteString("New todo: " + string(u.input) + "█\r\n")
+	case modeFilter:
+		b.WriteString("Filter: " + string(u.input) + "█\r\n")
+	case modeConfirmDelete:
+		b.WriteString("Delete this todo? (y/N)\r\n")
+	default:
+		b.WriteString(fit(u.message, width) + "\r\n")
+	}
+	b.WriteString(escDim + fit("j/k move  space toggle  e edit  a add  d delete  J/K reorder  / filter  r reload  q quit", width) + ansiReset)
+
+	os.Stdout.WriteString(b.String())
+}
+
+// fit truncates or pads s to exactly width runes.
+func fit(s string, width int) string {
+	r := []rune(s)
+	if len(r) > width {
+		if width <= 1 {
+			return string(r[:width])
+		}
+		return string(r[:width-1]) + "…"
+	}
+	return s + strings.Repeat(" ", width-len(r))
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDecodeKey(t *testing.T) {
+	tests := []struct {
+		in   string
+		key  rune
+		size int
+	}{
+		{"\033[A", keyUp, 3},
+		{"\033[Bj", keyDown, 3},
+		{"\033OC", keyRight, 3},
+		{"\033[1;5D", keyLeft, 6},
+		{"\033[H", keyNone, 3},     // Home
+		{"\033[3~", keyNone, 4},    // Delete
+		{"\033[5~q", keyNone, 4},   // PgUp
+		{"\033[15;2~", keyNone, 7}, // Shift+F5
+		{"\033OP", keyNone, 3},     // F1
+		{"\033q", keyEscape, 1},
+		{"\033\033[A", keyEscape, 1},
+		{"\033[\r", keyEscape, 1},
+		{"\r", keyEnter, 1},
+		{"\x7f", keyBackspace, 1},
+		{"\x03", keyCtrlC, 1},
+		{"é", 'é', 2},
+
+		// Incomplete sequences wait for more input.
+		{"\033", 0, 0},
+		{"\033[", 0, 0},
+		{"\033[5", 0, 0},
+		{"\033O", 0, 0},
+		{"\xc3", 0, 0},
+	}
+	for _, tt := range tests {
+		key, size := decodeKey([]byte(tt.in))
+		if key != tt.key || size != tt.size {
+			t.Errorf("decodeKey(%q) = %d, %d; want %d, %d", tt.in, key, size, tt.key, tt.size)
+		}
+	}
+}
+
+// readAllKeys feeds chunks to readKeys one write at a time, pausing after
+// the ones in pauseAfter, and returns the keys it produced.
+func readAllKeys(chunks []string, pauseAfter int) []rune {
+	r, w := io.Pipe()
+	keys := make(chan rune)
+	go readKeys(r, keys)
+	go func() {
+		for i, c := range chunks {
+			w.Write([]byte(c))
+			if i == pauseAfter {
+				time.Sleep(2 * escTimeout)
+			}
+		}
+		w.Close()
+	}()
+
+	var got []rune
+	for key := range keys {
+		got = append(got, key)
+	}
+	return got
+}
+
+func TestReadKeys(t *testing.T) {
+	tests := []struct {
+		name       string
+		chunks     []string
+		pauseAfter int
+		want       []rune
+	}{
+		{"split arrow", []string{"\033", "[", "A"}, -1, []rune{keyUp}},
+		{"split delete", []string{"\033[3", "~j"}, -1, []rune{'j'}},
+		{"escape alone", []string{"\033", "j"}, 0, []rune{keyEscape, 'j'}},
+		{"escape then bracket", []string{"\033", "[j"}, 0, []rune{keyEscape, '[', 'j'}},
+		{"keys around Home", []string{"k\033[Hj"}, -1, []rune{'k', 'j'}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := readAllKeys(tt.chunks, tt.pauseAfter); !slices.Equal(got, tt.want) {
+				t.Errorf("keys = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}